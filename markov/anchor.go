@@ -0,0 +1,63 @@
+package main
+
+import "slices"
+
+// backward returns a view of the model whose chain is the Backward chain.
+func (m *Model[T]) backward() *Model[T] {
+	b := *m
+	b.Chain, b.Backward, b.Index, b.kn = m.Backward, nil, nil, nil
+	return &b
+}
+
+// GenerateAround samples a sequence containing anchor, grown in both
+// directions up to the beginning and the end of a sequence. The model must
+// have been trained with a Backward chain.
+func (m *Model[T]) GenerateAround(anchor []T) ([]T, error) {
+	out, err := m.anchored(anchor, GenerateOptions{})
+	return m.Vocab.Symbols(out), err
+}
+
+// anchored samples a sequence containing anchor. A key ending with the
+// anchor is picked from the chain and grown rightwards to the end of a
+// sequence, then the Backward chain grows it leftwards to the beginning.
+func (m *Model[T]) anchored(anchor []T, opts GenerateOptions) ([]Token, error) {
+	if m.Backward == nil {
+		return nil, ErrBackward
+	}
+	seed := make([]Token, len(anchor))
+	for i, w := range anchor {
+		if seed[i] = m.Vocab.IDs[w]; seed[i] == None {
+			return nil, ErrAnchor
+		}
+	}
+	// The key supplies up to Order-1 tokens of left context for short anchors.
+	key := m.start()
+	for _, id := range seed {
+		copy(key[:], key[1:m.Order])
+		key[m.Order-1] = id
+	}
+	n := min(len(seed), m.Order)
+	key, ok := m.ending(key, n)
+	if !ok {
+		return nil, ErrAnchor
+	}
+	left := slices.DeleteFunc(slices.Clone(key[:m.Order-n]), func(id Token) bool { return id == BOS })
+	right, err := m.walk(key, opts)
+	seq := append(append(left, seed...), right...)
+	if err != nil || slices.Contains(key[:m.Order-n], BOS) {
+		return seq, err
+	}
+	// The reversed sequence so far ends with the first tokens of seq.
+	b := m.backward()
+	back := b.start()
+	for i := min(len(seq), m.Order) - 1; i >= 0; i-- {
+		copy(back[:], back[1:m.Order])
+		back[m.Order-1] = seq[i]
+	}
+	if b.Backoff == NoBackoff && b.follow(back, b.Order) == nil {
+		return seq, ErrAnchor
+	}
+	left, err = b.walk(back, opts)
+	slices.Reverse(left)
+	return append(left, seq...), err
+}
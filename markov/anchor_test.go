@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"math/rand"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestAnchored(t *testing.T) {
+	lines := []string{"the big ship sailed away", "a ship sank", "we saw the ship", "we sailed away"}
+	newModel := func() *Markov {
+		m := NewMarkov(2)
+		m.Backward = map[NGram]*Transitions{}
+		m.RNG = rand.New(rand.NewSource(1)).Intn
+		return m
+	}
+	m := newModel()
+	seqs := make(chan []string, len(lines))
+	for _, line := range lines {
+		m.Add(strings.Fields(line))
+		seqs <- strings.Fields(line)
+	}
+	close(seqs)
+	// Every generated transition, including the first and the last one, was
+	// seen in training.
+	valid := func(words []string) bool {
+		key := m.start()
+		for _, next := range append(m.tokens(words), EOS) {
+			if t := m.follow(key, m.Order); t == nil || t.find(next) < 0 {
+				return false
+			}
+			copy(key[:], key[1:m.Order])
+			key[m.Order-1] = next
+		}
+		return true
+	}
+	seen := map[string]bool{}
+	for i := 0; i < 50; i++ {
+		for _, anchor := range []string{"ship", "the big ship", "sailed"} {
+			s, err := m.GenerateWith(GenerateOptions{Anchor: strings.Fields(anchor)})
+			if err != nil || !strings.Contains(s, anchor) || !valid(strings.Fields(s)) {
+				t.Fatal(anchor, s, err)
+			}
+			seen[s] = true
+		}
+	}
+	for _, line := range lines {
+		if !seen[line] {
+			t.Error(line, seen)
+		}
+	}
+	// MaxTokens bounds both halves and the anchor together
+	for i := 0; i < 50; i++ {
+		s, err := m.GenerateWith(GenerateOptions{Anchor: []string{"ship"}, MaxTokens: 3, Retries: 20})
+		if n := len(strings.Fields(s)); err != nil || n > 3 {
+			t.Fatal(s, err)
+		}
+	}
+	if _, err := m.GenerateAround([]string{"boat"}); err != ErrAnchor {
+		t.Error(err)
+	}
+	if _, err := m.GenerateAround([]string{"sank", "ship"}); err != ErrAnchor {
+		t.Error(err)
+	}
+	if _, err := NewMarkov(2).GenerateAround([]string{"ship"}); err != ErrBackward {
+		t.Error(err)
+	}
+
+	var buf bytes.Buffer
+	if err := m.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded := NewMarkov(1)
+	if err := loaded.Load(&buf); err != nil || len(loaded.Backward) != len(m.Backward) {
+		t.Fatal(err, len(loaded.Backward))
+	}
+	if par := Train(newModel, seqs, 2); len(par.Backward) != len(m.Backward) {
+		t.Error(len(par.Backward), len(m.Backward))
+	}
+	if s, err := m.Freeze().Generate(rand.Intn, GenerateOptions{Anchor: []string{"ship"}}); err != nil || !slices.Contains(strings.Fields(s), "ship") {
+		t.Error(s, err)
+	}
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// arpaScale converts ARPA probabilities to the counts of an imported chain.
+const arpaScale = 1 << 20
+
+var ErrARPA = errors.New("markov: malformed ARPA file")
+
+// ARPA is the smoothing of a model read from an ARPA file: the listed
+// log10 probabilities of n-grams, and backoff weights of their prefixes for
+// the n-grams that are not listed.
+type ARPA struct {
+	probs    map[arpaKey]float64
+	backoffs map[arpaKey]float64
+}
+
+// arpaKey holds the tokens of an n-gram in its first n slots, an n-gram
+// may be one token longer than a prefix. Unlike chain keys it may hold
+// None, which stands for <unk>.
+type arpaKey struct {
+	gram [MaxOrder + 1]Token
+	n    int
+}
+
+// arpaGram is an n-gram line of an ARPA file.
+type arpaGram struct {
+	words     []string
+	prob, bow float64
+}
+
+func newARPAKey(tokens ...Token) (k arpaKey) {
+	k.n = copy(k.gram[:], tokens)
+	return k
+}
+
+// Prob backs off from the longest listed n-gram ending with w. The context
+// starts after the last unknown word, and a padded beginning of a sequence
+// is a single <s>.
+func (a *ARPA) Prob(m counts, key NGram, w Token) float64 {
+	ctx := key[:m.order()]
+	for i, id := range key[:m.order()] {
+		if id == None {
+			ctx = key[i+1 : m.order()]
+		}
+	}
+	for len(ctx) > 1 && ctx[0] == BOS && ctx[1] == BOS {
+		ctx = ctx[1:]
+	}
+	lp := 0.0
+	for i := 0; i <= len(ctx); i++ {
+		if p, ok := a.probs[newARPAKey(append(slices.Clip(ctx[i:]), w)...)]; ok {
+			return math.Pow(10, lp+p)
+		}
+		if i < len(ctx) {
+			lp += a.backoffs[newARPAKey(ctx[i:]...)]
+		}
+	}
+	if p, ok := a.probs[newARPAKey(None)]; ok {
+		return math.Pow(10, lp+p)
+	}
+	return 0
+}
+
+// arpaWord returns how a token is written in ARPA files.
+func (m *Markov) arpaWord(id Token) string {
+	switch id {
+	case None:
+		return "<unk>"
+	case BOS:
+		return "<s>"
+	case EOS:
+		return "</s>"
+	}
+	return m.Vocab.Words[id]
+}
+
+// arpaID returns the token of a word of an ARPA file, interning it if needed.
+func (m *Markov) arpaID(word string) Token {
+	switch word {
+	case "<unk>":
+		return None
+	case "<s>":
+		return BOS
+	case "</s>":
+		return EOS
+	}
+	return m.Vocab.ID(word)
+}
+
+// arpaContext returns the full-length key for an ARPA context: a beginning
+// of a sequence is padded with BOS, other contexts with None, so that
+// smoothing only uses its last len(ctx) tokens.
+func (m *Markov) arpaContext(ctx []Token) (key NGram) {
+	pad := None
+	if len(ctx) > 0 && ctx[0] == BOS {
+		pad = BOS
+	}
+	for i := 0; i < m.Order-len(ctx); i++ {
+		key[i] = pad
+	}
+	copy(key[m.Order-len(ctx):m.Order], ctx)
+	return key
+}
+
+// WriteARPA writes the model in the ARPA format of n-gram language models,
+// with n-grams up to Order+1 tokens long. Every n-gram that was seen is
+// listed with its probability under the model's Smoothing. Backoff weights
+// are chosen so that the probabilities of n-grams that are not listed sum
+// up to one with the listed ones.
+func (m *Markov) WriteARPA(w io.Writer) error {
+	// grams[n] maps contexts of n tokens to the words seen after them.
+	grams := make([]map[arpaKey][]Token, m.Order+1)
+	for n := range grams {
+		grams[n] = map[arpaKey][]Token{}
+	}
+	seen := map[arpaKey]bool{}
+	for _, key := range m.states() {
+		for _, next := range m.Chain[key].Next {
+			for n := 0; n <= m.Order; n++ {
+				ctx := key[m.Order-n : m.Order]
+				if n > 1 && ctx[1] == BOS {
+					continue // only the last BOS of the padding is written
+				}
+				gram := newARPAKey(append(slices.Clip(ctx), next)...)
+				if !seen[gram] {
+					seen[gram] = true
+					c := newARPAKey(ctx...)
+					grams[n][c] = append(grams[n][c], next)
+				}
+			}
+		}
+	}
+	unigrams := []Token{None}
+	for id := range m.Vocab.Words[EOS:] {
+		unigrams = append(unigrams, EOS+Token(id))
+	}
+	grams[0][arpaKey{}] = unigrams
+
+	prob := func(ctx []Token, next Token) float64 {
+		return m.Smoothing.Prob(m, m.arpaContext(ctx), next)
+	}
+	backoff := func(ctx []Token) (float64, bool) {
+		next, ok := grams[len(ctx)][newARPAKey(ctx...)]
+		if !ok {
+			return 0, false
+		}
+		num, den := 1.0, 1.0
+		for _, w := range next {
+			num -= prob(ctx, w)
+			den -= prob(ctx[1:], w)
+		}
+		if num <= 0 || den <= 0 {
+			return -99, true
+		}
+		return math.Log10(num / den), true
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "\n\\data\\")
+	for n := range grams {
+		total := 0
+		for _, next := range grams[n] {
+			total += len(next)
+		}
+		if n == 0 {
+			total++ // <s>
+		}
+		fmt.Fprintf(bw, "ngram %d=%d\n", n+1, total)
+	}
+	for n := range grams {
+		fmt.Fprintf(bw, "\n\\%d-grams:\n", n+1)
+		if n == 0 {
+			bow, _ := backoff([]Token{BOS})
+			fmt.Fprintf(bw, "-99\t<s>\t%.6f\n", bow)
+		}
+		ctxs := make([]arpaKey, 0, len(grams[n]))
+		for c := range grams[n] {
+			ctxs = append(ctxs, c)
+		}
+		slices.SortFunc(ctxs, func(a, b arpaKey) int { return slices.Compare(a.gram[:], b.gram[:]) })
+		for _, c := range ctxs {
+			ctx := c.gram[:n]
+			for _, next := range grams[n][c] {
+				words := make([]string, 0, n+1)
+				for _, id := range append(slices.Clip(ctx), next) {
+					word := m.arpaWord(id)
+					if word == "" || strings.ContainsFunc(word, isSpace) || (id > EOS && slices.Contains([]string{"<unk>", "<s>", "</s>"}, word)) {
+						return fmt.Errorf("markov: %q cannot be written to an ARPA file", word)
+					}
+					words = append(words, word)
+				}
+				fmt.Fprintf(bw, "%.6f\t%s", math.Log10(prob(ctx, next)), strings.Join(words, " "))
+				if n < m.Order {
+					if bow, ok := backoff(append(slices.Clip(ctx), next)); ok {
+						fmt.Fprintf(bw, "\t%.6f", bow)
+					}
+				}
+				fmt.Fprintln(bw)
+			}
+		}
+	}
+	fmt.Fprintln(bw, "\n\\end\\")
+	return bw.Flush()
+}
+
+func isSpace(r rune) bool { return r == ' ' || r == '\t' || r == '\n' || r == '\r' }
+
+// ReadARPA returns a model of the n-grams of an ARPA file, with an Order
+// one less than the longest n-grams. Scoring uses the probabilities of the
+// file through the ARPA smoothing, which is not saved by Save. Generation
+// samples from counts proportional to the listed probabilities with stupid
+// backoff.
+func ReadARPA(r io.Reader) (*Markov, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxLine)
+	var grams []arpaGram
+	// n is the length of the n-grams of the current section, 0 in the
+	// header and -1 outside of the data.
+	orders, n, line := 0, -1, 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		var count int
+		switch {
+		case text == "":
+		case text == `\data\`:
+			n = 0
+		case text == `\end\`:
+			n = -1
+		case strings.HasPrefix(text, `\`) && strings.HasSuffix(text, "-grams:"):
+			var err error
+			if n, err = strconv.Atoi(text[1 : len(text)-len("-grams:")]); err != nil || n < 1 || n > orders {
+				return nil, fmt.Errorf("line %d: %w", line, ErrARPA)
+			}
+		case n == 0:
+			if _, err := fmt.Sscanf(text, "ngram %d=%d", &orders, &count); err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, ErrARPA)
+			}
+		case n > 0:
+			fields := strings.Fields(text)
+			g := arpaGram{words: fields[1:min(n+1, len(fields))]}
+			var err error
+			if g.prob, err = strconv.ParseFloat(fields[0], 64); err != nil || len(g.words) != n {
+				return nil, fmt.Errorf("line %d: %w", line, ErrARPA)
+			}
+			if len(fields) == n+2 {
+				if g.bow, err = strconv.ParseFloat(fields[n+1], 64); err != nil || n == orders {
+					return nil, fmt.Errorf("line %d: %w", line, ErrARPA)
+				}
+			} else if len(fields) != n+1 {
+				return nil, fmt.Errorf("line %d: %w", line, ErrARPA)
+			}
+			grams = append(grams, g)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if orders < 1 || orders > MaxOrder+1 {
+		return nil, ErrARPA
+	}
+
+	m := NewMarkov(max(1, orders-1))
+	m.Backoff = StupidBackoff
+	a := &ARPA{probs: map[arpaKey]float64{}, backoffs: map[arpaKey]float64{}}
+	m.Smoothing = a
+	for _, g := range grams {
+		tokens := make([]Token, len(g.words))
+		for i, word := range g.words {
+			tokens[i] = m.arpaID(word)
+		}
+		k := newARPAKey(tokens...)
+		a.probs[k] = g.prob
+		if g.bow != 0 {
+			a.backoffs[k] = g.bow
+		}
+		ctx, next := tokens[:len(tokens)-1], tokens[len(tokens)-1]
+		if next == BOS || next == None || slices.Contains(ctx, None) || g.prob <= -99 {
+			continue
+		}
+		// Like a model trained with backoff, shorter contexts have
+		// shorter keys, but the beginning of a sequence is padded.
+		key := NGram{}
+		if len(ctx) == m.Order || (len(ctx) > 0 && ctx[0] == BOS) {
+			key = m.arpaContext(ctx)
+		} else {
+			copy(key[:], ctx)
+		}
+		if m.count(key, next, max(1, int(math.Round(math.Pow(10, g.prob)*arpaScale)))) {
+			m.edges++
+		}
+	}
+	return m, nil
+}
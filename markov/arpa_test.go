@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestARPA(t *testing.T) {
+	b, err := os.ReadFile("homer.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(string(b), "\n")
+	for _, test := range []struct {
+		Order     int
+		Smoothing Smoothing
+		Backoff   Backoff
+	}{
+		{1, KneserNey{D: 0.75}, NoBackoff},
+		{2, KneserNey{D: 0.75}, NoBackoff},
+		{3, KneserNey{D: 0.5}, Interpolated},
+		{2, AddK{K: 0.1}, NoBackoff},
+	} {
+		m := NewMarkov(test.Order)
+		m.Smoothing, m.Backoff = test.Smoothing, test.Backoff
+		for _, line := range lines[:300] {
+			m.Add(strings.Fields(line))
+		}
+		var buf bytes.Buffer
+		if err := m.WriteARPA(&buf); err != nil {
+			t.Fatal(err)
+		}
+		imported, err := ReadARPA(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if imported.Order != m.Order {
+			t.Fatal(imported.Order)
+		}
+		// Probabilities are written with 6 decimals of their log10
+		for _, line := range append(lines[290:310], "Homer ate a zebra") {
+			words := strings.Fields(line)
+			if want, got := m.LogProb(words), imported.LogProb(words); math.Abs(want-got) > 1e-5*float64(len(words)+1) {
+				t.Error(test.Order, test.Smoothing, line, want, got)
+			}
+		}
+		// Backed off probabilities still sum up to one
+		key := imported.context([]string{"Homer", "ate"})
+		sum := 0.0
+		for id := range imported.Vocab.Words {
+			if Token(id) != BOS {
+				sum += imported.Smoothing.Prob(imported.Model, key, Token(id))
+			}
+		}
+		if math.Abs(sum-1) > 1e-3 {
+			t.Error(test.Order, test.Smoothing, sum)
+		}
+		if s := imported.Generate(); s == "" {
+			t.Error(s)
+		}
+	}
+}
+
+func TestReadARPA(t *testing.T) {
+	arpa := `
+\data\
+ngram 1=4
+ngram 2=3
+
+\1-grams:
+-99	<s>	-0.30103
+-0.30103	a	-0.30103
+-0.60206	b
+-0.60206	</s>
+
+\2-grams:
+-0.30103	<s> a
+-0.30103	a b
+-0.30103	b </s>
+
+\end\
+`
+	m, err := ReadARPA(strings.NewReader(arpa))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		Words []string
+		Prob  float64
+	}{
+		{[]string{"a", "b"}, 0.5 * 0.5 * 0.5},
+		{[]string{"a"}, 0.5 * 0.5 * 0.25}, // a </s> backs off
+		{[]string{"b"}, 0.5 * 0.25 * 0.5}, // <s> b backs off
+		{[]string{"c"}, 0},                // <unk> is not listed
+	} {
+		if p := math.Exp(m.LogProb(test.Words)); math.Abs(p-test.Prob) > 1e-6 {
+			t.Error(test.Words, p, test.Prob)
+		}
+	}
+	for _, bad := range []string{
+		"\\data\\\nngram 1=1\n\\1-grams:\n-1\n",
+		"\\data\\\nngram 1=1\n\\2-grams:\n-1 a b\n",
+		"\\data\\\nngram 1=1\n\\1-grams:\nx a\n",
+		"\\data\\\nngram 1=1\nngram 2=1\n\\2-grams:\n-1 a b -0.5\n",
+		"",
+	} {
+		if _, err := ReadARPA(strings.NewReader(bad)); !errors.Is(err, ErrARPA) {
+			t.Errorf("%q: %v", bad, err)
+		}
+	}
+	// Words spelled like reserved tokens cannot be written
+	for _, word := range []string{"</s>", "<unk>", "two words"} {
+		m := NewMarkov(1)
+		m.Add([]string{"a", word})
+		words := len(m.Vocab.Words)
+		if err := m.WriteARPA(io.Discard); err == nil || len(m.Vocab.Words) != words {
+			t.Error(word, err)
+		}
+	}
+}
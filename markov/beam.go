@@ -0,0 +1,64 @@
+package main
+
+import (
+	"math"
+	"slices"
+	"sort"
+)
+
+// Hypothesis is a complete sequence found by Beam.
+type Hypothesis struct {
+	Text    string
+	Tokens  []string
+	LogProb float64 // of the generated tokens and the end of the sequence
+}
+
+type beam struct {
+	key     NGram
+	tokens  []Token
+	logProb float64
+}
+
+// Beam returns up to n most probable complete sequences continuing prompt,
+// most probable first. At every step only the width best partial sequences
+// are extended, and at most maxLen tokens are generated.
+func (m *Markov) Beam(prompt []string, width, n, maxLen int) []Hypothesis {
+	var done []Hypothesis
+	beams := []beam{{key: m.context(prompt)}}
+	for step := 0; step <= maxLen && len(beams) > 0; step++ {
+		var next []beam
+		for _, b := range beams {
+			tokens, probs := m.dist(b.key)
+			for i, w := range tokens {
+				lp := b.logProb + math.Log(probs[i])
+				if w == EOS {
+					words := append(slices.Clip(prompt), m.Vocab.Symbols(b.tokens)...)
+					done = append(done, Hypothesis{m.Join(words), words, lp})
+					continue
+				}
+				if step == maxLen {
+					continue
+				}
+				key := b.key
+				copy(key[:], key[1:m.Order])
+				key[m.Order-1] = w
+				next = append(next, beam{key, append(slices.Clip(b.tokens), w), lp})
+			}
+		}
+		sort.SliceStable(next, func(i, j int) bool { return next[i].logProb > next[j].logProb })
+		sort.SliceStable(done, func(i, j int) bool { return done[i].LogProb > done[j].LogProb })
+		if len(next) > width {
+			next = next[:width]
+		}
+		if len(done) > n {
+			done = done[:n]
+		}
+		// Log probabilities only decrease, so once the worst kept sequence
+		// beats the best partial one nothing can replace it.
+		if len(done) == n && len(next) > 0 && next[0].logProb < done[n-1].LogProb {
+			break
+		}
+		beams = next
+	}
+	return done
+}
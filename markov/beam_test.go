@@ -0,0 +1,33 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestBeam(t *testing.T) {
+	m := NewMarkov(2)
+	m.Add(strings.Fields("Mary had a little lamb little lamb little lamb"))
+	m.Add(strings.Fields("Old McDonald had a farm"))
+	hyps := m.Beam(nil, 5, 3, 20)
+	for i, want := range []struct {
+		Text string
+		Prob float64
+	}{
+		{"Mary had a farm", 0.25},
+		{"Old McDonald had a farm", 0.25},
+		{"Mary had a little lamb", 0.25 / 3},
+	} {
+		if i >= len(hyps) || hyps[i].Text != want.Text || math.Abs(math.Exp(hyps[i].LogProb)-want.Prob) > 1e-9 {
+			t.Fatal(i, hyps)
+		}
+	}
+	hyps = m.Beam(strings.Fields("a little"), 5, 2, 3)
+	if len(hyps) != 2 || hyps[0].Text != "a little lamb" || hyps[1].Text != "a little lamb little lamb" {
+		t.Fatal(hyps)
+	}
+	if hyps = m.Beam(strings.Fields("a little"), 5, 2, 2); len(hyps) != 1 {
+		t.Fatal(hyps)
+	}
+}
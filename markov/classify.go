@@ -0,0 +1,80 @@
+package main
+
+import "math"
+
+// Classifier trains one model per label and assigns text to the label whose
+// model gives it the highest smoothed likelihood. All models are smoothed
+// over the words of every label, so unknown words cost the same in each.
+type Classifier struct {
+	Labels []string
+	Models map[string]*Markov
+	New    func() *Markov // creates the model of a new label
+	words  map[string]bool
+}
+
+// sharedVocab is a model whose smoothing assumes a vocabulary of size words.
+type sharedVocab struct {
+	counts
+	size int
+}
+
+// Confusion counts predicted labels for each actual label.
+type Confusion map[string]map[string]int
+
+func NewClassifier(newModel func() *Markov) *Classifier {
+	return &Classifier{Models: map[string]*Markov{}, New: newModel, words: map[string]bool{}}
+}
+
+func (c *Classifier) Add(label string, seq []string) {
+	m := c.Models[label]
+	if m == nil {
+		m = c.New()
+		c.Models[label] = m
+		c.Labels = append(c.Labels, label)
+	}
+	m.Add(seq)
+	for _, w := range seq {
+		c.words[w] = true
+	}
+}
+
+func (v sharedVocab) vocabSize() int { return v.size }
+
+// Classify returns the most likely label of a sequence and the log
+// probability of the sequence under each label's model.
+func (c *Classifier) Classify(seq []string) (label string, scores map[string]float64) {
+	best := math.Inf(-1)
+	scores = map[string]float64{}
+	for _, l := range c.Labels {
+		m := c.Models[l]
+		scores[l] = m.logProb(sharedVocab{m.Model, len(c.words) + 2}, seq) // words, EOS and None
+		if scores[l] > best {
+			best, label = scores[l], l
+		}
+	}
+	return label, scores
+}
+
+func (c Confusion) Add(actual, predicted string) {
+	if c[actual] == nil {
+		c[actual] = map[string]int{}
+	}
+	c[actual][predicted]++
+}
+
+// Accuracy returns the share of correct predictions.
+func (c Confusion) Accuracy() float64 {
+	correct, total := 0, 0
+	for actual, row := range c {
+		for predicted, n := range row {
+			if actual == predicted {
+				correct += n
+			}
+			total += n
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(correct) / float64(total)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"math"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestClassifier(t *testing.T) {
+	c := NewClassifier(func() *Markov { return NewMarkov(2) })
+	for label, file := range map[string]string{"homer": "homer.txt", "paulgraham": "paulgraham.txt"} {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, line := range strings.Split(string(b), "\n")[:1000] {
+			c.Add(label, strings.Fields(line))
+		}
+	}
+	conf := Confusion{}
+	for _, test := range []struct{ Label, Text string }{
+		{"homer", "Mmm... donuts. Marge, where's my beer?"},
+		{"homer", "D'oh! Stupid Flanders!"},
+		{"paulgraham", "The best way to get startup ideas is to notice problems in your own life."},
+		{"paulgraham", "Investors are more interested in founders than ideas."},
+	} {
+		label, scores := c.Classify(strings.Fields(test.Text))
+		if len(scores) != 2 {
+			t.Error(scores)
+		}
+		conf.Add(test.Label, label)
+	}
+	if conf.Accuracy() != 1 {
+		t.Error(conf)
+	}
+}
+
+func TestClassifierVocab(t *testing.T) {
+	c := NewClassifier(func() *Markov {
+		m := NewMarkov(2)
+		m.Smoothing = AddK{K: 1}
+		return m
+	})
+	c.Add("short", strings.Fields("x y"))
+	c.Add("long", strings.Fields("p q r s t u v w"))
+	// Unknown words are as likely for a label with a small vocabulary
+	if _, scores := c.Classify([]string{"z"}); math.Abs(scores["short"]-scores["long"]) > 1e-12 {
+		t.Error(scores)
+	}
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// compressMagic starts a compressed stream, followed by the model order.
+const compressMagic = "MKZ"
+
+const (
+	codeBits    = 32
+	codeHalf    = 1 << (codeBits - 1)
+	codeQuarter = 1 << (codeBits - 2)
+	// maxTotal bounds the counts of a context, which are halved above it.
+	// This keeps the model adaptive and totals well below codeQuarter.
+	maxTotal = 1 << 16
+	// rawSymbols are the bytes and the end of the stream, coded uniformly
+	// when no context has seen them.
+	rawSymbols = 257
+)
+
+// encoder is an arithmetic coder writing the bits of a shrinking interval.
+type encoder struct {
+	w         *bufio.Writer
+	low, high uint64
+	pending   int // opposite bits to follow the next bit
+	bits      byte
+	n         int
+}
+
+func newEncoder(w io.Writer) *encoder {
+	return &encoder{w: bufio.NewWriter(w), high: 1<<codeBits - 1}
+}
+
+// encode narrows the interval to [lo, hi) out of total.
+func (e *encoder) encode(lo, hi, total int) {
+	r := e.high - e.low + 1
+	e.high = e.low + r*uint64(hi)/uint64(total) - 1
+	e.low += r * uint64(lo) / uint64(total)
+	for {
+		switch {
+		case e.high < codeHalf:
+			e.bit(0)
+		case e.low >= codeHalf:
+			e.bit(1)
+			e.low, e.high = e.low-codeHalf, e.high-codeHalf
+		case e.low >= codeQuarter && e.high < codeHalf+codeQuarter:
+			e.pending++
+			e.low, e.high = e.low-codeQuarter, e.high-codeQuarter
+		default:
+			return
+		}
+		e.low, e.high = 2*e.low, 2*e.high+1
+	}
+}
+
+func (e *encoder) bit(b byte) {
+	e.put(b)
+	for ; e.pending > 0; e.pending-- {
+		e.put(1 - b)
+	}
+}
+
+func (e *encoder) put(b byte) {
+	e.bits = e.bits<<1 | b
+	if e.n++; e.n == 8 {
+		e.w.WriteByte(e.bits)
+		e.bits, e.n = 0, 0
+	}
+}
+
+// close writes enough bits to identify the final interval.
+func (e *encoder) close() error {
+	e.pending++
+	if e.low < codeQuarter {
+		e.bit(0)
+	} else {
+		e.bit(1)
+	}
+	if e.n > 0 {
+		e.w.WriteByte(e.bits << (8 - e.n))
+	}
+	return e.w.Flush()
+}
+
+// decoder follows the intervals of an encoder from its bits.
+type decoder struct {
+	r                *bufio.Reader
+	low, high, value uint64
+	bits             byte
+	n                int
+	past             int // bits read after the end of the input
+	err              error
+}
+
+func newDecoder(r *bufio.Reader) *decoder {
+	d := &decoder{r: r, high: 1<<codeBits - 1}
+	for i := 0; i < codeBits; i++ {
+		d.value = 2*d.value + d.get()
+	}
+	return d
+}
+
+// target returns the position of the code within total.
+func (d *decoder) target(total int) int {
+	r := d.high - d.low + 1
+	return int(((d.value-d.low+1)*uint64(total) - 1) / r)
+}
+
+// decode narrows the interval to [lo, hi) out of total, like encode.
+func (d *decoder) decode(lo, hi, total int) {
+	r := d.high - d.low + 1
+	d.high = d.low + r*uint64(hi)/uint64(total) - 1
+	d.low += r * uint64(lo) / uint64(total)
+	for {
+		switch {
+		case d.high < codeHalf:
+		case d.low >= codeHalf:
+			d.low, d.high, d.value = d.low-codeHalf, d.high-codeHalf, d.value-codeHalf
+		case d.low >= codeQuarter && d.high < codeHalf+codeQuarter:
+			d.low, d.high, d.value = d.low-codeQuarter, d.high-codeQuarter, d.value-codeQuarter
+		default:
+			return
+		}
+		d.low, d.high, d.value = 2*d.low, 2*d.high+1, 2*d.value+d.get()
+	}
+}
+
+// get returns the next bit, or zeros after the end of the input.
+func (d *decoder) get() uint64 {
+	if d.n == 0 {
+		b, err := d.r.ReadByte()
+		if err != nil {
+			if err != io.EOF && d.err == nil {
+				d.err = err
+			}
+			if d.past++; d.past > codeBits && d.err == nil {
+				d.err = io.ErrUnexpectedEOF
+			}
+			return 0
+		}
+		d.bits, d.n = b, 8
+	}
+	d.n--
+	return uint64(d.bits>>d.n) & 1
+}
+
+// ppm predicts bytes from the contexts of a Markov chain trained as it
+// goes, escaping to shorter contexts for bytes a context has not seen.
+type ppm struct {
+	*Model[byte]
+	key      NGram
+	excluded [EOS + 1 + 256]bool
+}
+
+func newPPM(order int) *ppm {
+	p := &ppm{Model: NewModel[byte](order)}
+	p.Backoff = StupidBackoff
+	p.key = p.start()
+	return p
+}
+
+// escape returns the total of the counts of t that are not excluded and
+// the escape count, which is the number of such successors (method C).
+func (p *ppm) escape(t *Transitions) (sum, esc int) {
+	for i, next := range t.Next {
+		if !p.excluded[next] {
+			sum += t.Count[i]
+			esc++
+		}
+	}
+	return sum, esc
+}
+
+func (p *ppm) exclude(t *Transitions) {
+	for _, next := range t.Next {
+		p.excluded[next] = true
+	}
+}
+
+// encode codes the token s, or the byte b if s was never seen.
+func (p *ppm) encode(e *encoder, s Token, b byte) {
+	p.excluded = [len(p.excluded)]bool{}
+	for n := p.Order; n >= 0; n-- {
+		t := p.Chain[p.suffix(p.key, n)]
+		if t == nil {
+			continue
+		}
+		sum, esc := p.escape(t)
+		if esc == 0 {
+			continue
+		}
+		lo := 0
+		for i, next := range t.Next {
+			if next == s && !p.excluded[next] {
+				e.encode(lo, lo+t.Count[i], sum+esc)
+				return
+			}
+			if !p.excluded[next] {
+				lo += t.Count[i]
+			}
+		}
+		e.encode(sum, sum+esc, sum+esc)
+		p.exclude(t)
+	}
+	raw := int(b)
+	if s == EOS {
+		raw = 256
+	}
+	e.encode(raw, raw+1, rawSymbols)
+}
+
+// decode returns the next token, interning a byte never seen before.
+func (p *ppm) decode(d *decoder) Token {
+	p.excluded = [len(p.excluded)]bool{}
+	for n := p.Order; n >= 0; n-- {
+		t := p.Chain[p.suffix(p.key, n)]
+		if t == nil {
+			continue
+		}
+		sum, esc := p.escape(t)
+		if esc == 0 {
+			continue
+		}
+		target, lo := d.target(sum+esc), 0
+		if target < sum {
+			for i, next := range t.Next {
+				if p.excluded[next] {
+					continue
+				}
+				if target < lo+t.Count[i] {
+					d.decode(lo, lo+t.Count[i], sum+esc)
+					return next
+				}
+				lo += t.Count[i]
+			}
+		}
+		d.decode(sum, sum+esc, sum+esc)
+		p.exclude(t)
+	}
+	raw := d.target(rawSymbols)
+	d.decode(raw, raw+1, rawSymbols)
+	if raw == 256 {
+		return EOS
+	}
+	return p.Vocab.ID(byte(raw))
+}
+
+// update counts s after every context and moves on to the next one.
+func (p *ppm) update(s Token) {
+	for n := 0; n <= p.Order; n++ {
+		key := p.suffix(p.key, n)
+		p.count(key, s, 1)
+		if t := p.Chain[key]; t.Total > maxTotal {
+			t.Total = 0
+			for i, c := range t.Count {
+				t.Count[i] = (c + 1) / 2
+				t.Total += t.Count[i]
+			}
+		}
+	}
+	copy(p.key[:], p.key[1:p.Order])
+	p.key[p.Order-1] = s
+}
+
+// Compress writes the bytes of r to w, arithmetic coded with the
+// predictions of a Markov chain of the given order over bytes. The chain
+// is trained while coding, so Decompress rebuilds it from the stream.
+func Compress(w io.Writer, r io.Reader, order int) error {
+	if order < 1 || order > MaxOrder {
+		return fmt.Errorf("markov: order must be within 1..%d", MaxOrder)
+	}
+	bw := bufio.NewWriter(w)
+	bw.WriteString(compressMagic)
+	bw.WriteByte(byte(order))
+	p, e := newPPM(order), newEncoder(bw)
+	br := bufio.NewReader(r)
+	for {
+		b, err := br.ReadByte()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		s := p.Vocab.IDs[b]
+		p.encode(e, s, b)
+		if s == None {
+			s = p.Vocab.ID(b)
+		}
+		p.update(s)
+	}
+	p.encode(e, EOS, 0)
+	if err := e.close(); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// Decompress writes the bytes of a stream written by Compress to w.
+func Decompress(w io.Writer, r io.Reader) error {
+	br := bufio.NewReader(r)
+	header := make([]byte, len(compressMagic)+1)
+	if _, err := io.ReadFull(br, header); err != nil || string(header[:len(compressMagic)]) != compressMagic {
+		return ErrFormat
+	}
+	order := int(header[len(compressMagic)])
+	if order < 1 || order > MaxOrder {
+		return ErrFormat
+	}
+	p, d := newPPM(order), newDecoder(br)
+	bw := bufio.NewWriter(w)
+	for {
+		s := p.decode(d)
+		if d.err != nil {
+			return d.err
+		}
+		if s == EOS {
+			break
+		}
+		bw.WriteByte(p.Vocab.Words[s])
+		p.update(s)
+	}
+	return bw.Flush()
+}
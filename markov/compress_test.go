@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestCompress(t *testing.T) {
+	noise := make([]byte, 4096)
+	rand.New(rand.NewSource(1)).Read(noise)
+	homer, err := os.ReadFile("homer.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	essays, err := os.ReadFile("paulgraham.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		Name  string
+		Data  []byte
+		Order int
+		Bits  float64 // per byte at most
+	}{
+		{"empty", nil, 3, 0},
+		{"byte", []byte{0}, 1, 0},
+		{"bytes", []byte{0, 255, 0, 0, 1, 255}, 2, 0},
+		{"repeat", bytes.Repeat([]byte("Mary had a little lamb. "), 1000), 4, 0.1},
+		{"noise", noise, 2, 9.5},
+		{"text", []byte(strings.Repeat("Sing, O goddess, the anger of Achilles son of Peleus\n", 3) + "that brought countless ills upon the Achaeans."), 8, 0},
+		{"homer", homer[:64<<10], 4, 3},
+		{"essays", essays[:64<<10], 4, 3},
+	} {
+		var b bytes.Buffer
+		if err := Compress(&b, bytes.NewReader(test.Data), test.Order); err != nil {
+			t.Fatal(test.Name, err)
+		}
+		if bits := float64(8*b.Len()) / float64(len(test.Data)); test.Bits > 0 && bits > test.Bits {
+			t.Error(test.Name, bits)
+		}
+		var out bytes.Buffer
+		if err := Decompress(&out, &b); err != nil {
+			t.Fatal(test.Name, err)
+		}
+		if !bytes.Equal(out.Bytes(), test.Data) {
+			t.Error(test.Name, out.Len(), len(test.Data))
+		}
+	}
+}
+
+func TestDecompressErrors(t *testing.T) {
+	var b bytes.Buffer
+	if err := Compress(&b, strings.NewReader(strings.Repeat("little lamb ", 100)), 3); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		Name string
+		Data []byte
+		Err  error
+	}{
+		{"empty", nil, ErrFormat},
+		{"magic", []byte("markov 8\n"), ErrFormat},
+		{"order", []byte(compressMagic + "\x00"), ErrFormat},
+		{"truncated", b.Bytes()[:b.Len()/2], io.ErrUnexpectedEOF},
+	} {
+		if err := Decompress(io.Discard, bytes.NewReader(test.Data)); err != test.Err {
+			t.Error(test.Name, err)
+		}
+	}
+	if err := Compress(io.Discard, strings.NewReader("a"), MaxOrder+1); err == nil {
+		t.Error(err)
+	}
+}
+
+func BenchmarkCompress(b *testing.B) {
+	for _, name := range []string{"homer.txt", "paulgraham.txt"} {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(name, func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			var out bytes.Buffer
+			for i := 0; i < b.N; i++ {
+				out.Reset()
+				if err := Compress(&out, bytes.NewReader(data), 4); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(8*out.Len())/float64(len(data)), "bits/byte")
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// maxLine is the longest line, or sentence, that can be read.
+const maxLine = 64 << 20
+
+var (
+	gutenbergStart = regexp.MustCompile(`(?mi)^\*\*\*\s*START OF (THE|THIS) PROJECT GUTENBERG.*$|^\*END\*THE SMALL PRINT.*$`)
+	gutenbergEnd   = regexp.MustCompile(`(?mi)^\*\*\*\s*END OF (THE|THIS) PROJECT GUTENBERG.*$|^End of (the )?Project Gutenberg.*$`)
+	quotes         = strings.NewReplacer("‘", "'", "’", "'", "‚", "'", "‛", "'", "′", "'",
+		"“", `"`, "”", `"`, "„", `"`, "‟", `"`, "″", `"`, "«", `"`, "»", `"`)
+)
+
+// Corpus reads training sequences from text, cleaning it up first.
+type Corpus struct {
+	Gutenberg bool // keep only the text between Project Gutenberg headers and footers
+	Quotes    bool // replace typographic quotes and apostrophes with ASCII ones
+	Lower     bool // fold the text to lower case
+}
+
+// Clean applies the enabled clean-ups to text.
+func (c Corpus) Clean(text string) string {
+	if c.Gutenberg {
+		text = StripGutenberg(text)
+	}
+	if c.Quotes {
+		text = quotes.Replace(text)
+	}
+	if c.Lower {
+		text = strings.ToLower(text)
+	}
+	return text
+}
+
+// Read returns the sequences of the text read from r, split by m.
+func (c Corpus) Read(m *Markov, r io.Reader) ([][]string, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return sequences(m, strings.NewReader(c.Clean(string(b))))
+}
+
+// ReadFiles returns the sequences of all files named by paths, see Files.
+func (c Corpus) ReadFiles(m *Markov, paths []string) ([][]string, error) {
+	files, err := Files(paths)
+	if err != nil {
+		return nil, err
+	}
+	var seqs [][]string
+	for _, path := range files {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		s, err := c.Read(m, f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		seqs = append(seqs, s...)
+	}
+	return seqs, nil
+}
+
+// Files expands paths to the regular files they name. A path may be a
+// file, a directory, which is walked recursively, or a glob pattern.
+func Files(paths []string) (files []string, err error) {
+	for _, p := range paths {
+		matches, err := filepath.Glob(p)
+		if len(matches) == 0 {
+			// Names with [ or * are patterns too, but may name a file
+			if _, statErr := os.Stat(p); statErr == nil {
+				matches = []string{p}
+			} else if err == nil {
+				return nil, statErr
+			}
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("%s: %w", p, err)
+		}
+		for _, match := range matches {
+			err := filepath.WalkDir(match, func(path string, d fs.DirEntry, err error) error {
+				if err == nil && d.Type().IsRegular() {
+					files = append(files, path)
+				}
+				return err
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return files, nil
+}
+
+// StripGutenberg returns the text between the header and the footer of a
+// Project Gutenberg e-book, or all of the text if it has neither.
+func StripGutenberg(text string) string {
+	if loc := gutenbergStart.FindStringIndex(text); loc != nil {
+		text = text[loc[1]:]
+	}
+	if loc := gutenbergEnd.FindStringIndex(text); loc != nil {
+		text = text[:loc[0]]
+	}
+	return text
+}
+
+// sequences splits text into token sequences, one per line or sentence.
+func sequences(m *Markov, r io.Reader) (seqs [][]string, err error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxLine)
+	if m.Mode == Sentences {
+		scanner.Split(ScanSentences)
+	}
+	for scanner.Scan() {
+		seqs = append(seqs, m.Split(scanner.Text()))
+	}
+	if err := scanner.Err(); err != nil {
+		return seqs, fmt.Errorf("after %d sequences: %w", len(seqs), err)
+	}
+	return seqs, nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStripGutenberg(t *testing.T) {
+	for _, test := range []struct {
+		Text, Want string
+	}{
+		{"Sing, O goddess", "Sing, O goddess"},
+		{"The Project Gutenberg EBook of The Iliad\r\n*** START OF THE PROJECT GUTENBERG EBOOK THE ILIAD ***\r\nSing, O goddess\r\n*** END OF THE PROJECT GUTENBERG EBOOK THE ILIAD ***\r\nlicense", "\nSing, O goddess\r\n"},
+		{"header\n***START OF THIS PROJECT GUTENBERG EBOOK ODYSSEY***\nTell me, O muse\nEnd of the Project Gutenberg EBook of The Odyssey\n", "\nTell me, O muse\n"},
+		{"Tell me, O muse\n*** END OF THE PROJECT GUTENBERG EBOOK ***", "Tell me, O muse\n"},
+	} {
+		if s := StripGutenberg(test.Text); s != test.Want {
+			t.Errorf("%q", s)
+		}
+	}
+}
+
+func TestCorpus(t *testing.T) {
+	c := Corpus{Quotes: true, Lower: true}
+	if s := c.Clean("“Don’t,” she said ‘quietly’."); s != `"don't," she said 'quietly'.` {
+		t.Error(s)
+	}
+	m := NewMarkov(2)
+	m.Mode = Sentences
+	seqs, err := c.Read(m, strings.NewReader("“Hello there,” he said.\nHow are\nyou?"))
+	want := [][]string{{`"`, "hello", "there", ",", `"`, "he", "said", "."}, {"how", "are", "you", "?"}}
+	if err != nil || !reflect.DeepEqual(seqs, want) {
+		t.Error(seqs, err)
+	}
+}
+
+func TestSequences(t *testing.T) {
+	long := strings.Repeat("a ", 64<<10)
+	seqs, err := sequences(NewMarkov(2), strings.NewReader("a b\n"+long+"\nc\n"))
+	if err != nil || len(seqs) != 3 || len(seqs[1]) != 64<<10 {
+		t.Error(len(seqs), err)
+	}
+	_, err = sequences(NewMarkov(2), strings.NewReader("a b\n"+strings.Repeat("a", maxLine+1)))
+	if !errors.Is(err, bufio.ErrTooLong) {
+		t.Error(err)
+	}
+}
+
+func TestFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.txt", "b.md", "sub/c.txt", "sub/deep/d.txt", "odd/[x].txt", "odd/y[.txt"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(name+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rel := func(files []string) (names []string) {
+		for _, f := range files {
+			name, _ := filepath.Rel(dir, f)
+			names = append(names, filepath.ToSlash(name))
+		}
+		return names
+	}
+	for _, test := range []struct {
+		Paths []string
+		Want  []string
+	}{
+		{[]string{"a.txt"}, []string{"a.txt"}},
+		{[]string{"sub"}, []string{"sub/c.txt", "sub/deep/d.txt"}},
+		{[]string{"*.txt", "sub/*/*.txt"}, []string{"a.txt", "sub/deep/d.txt"}},
+		{[]string{"."}, []string{"a.txt", "b.md", "odd/[x].txt", "odd/y[.txt", "sub/c.txt", "sub/deep/d.txt"}},
+		// Names that look like patterns but match no other file
+		{[]string{"odd/[x].txt", "odd/y[.txt"}, []string{"odd/[x].txt", "odd/y[.txt"}},
+	} {
+		paths := make([]string, len(test.Paths))
+		for i, p := range test.Paths {
+			paths[i] = filepath.Join(dir, p)
+		}
+		files, err := Files(paths)
+		if err != nil || !reflect.DeepEqual(rel(files), test.Want) {
+			t.Error(test.Paths, rel(files), err)
+		}
+	}
+	for _, p := range []string{"missing.txt", "*.go"} {
+		if _, err := Files([]string{filepath.Join(dir, p)}); !errors.Is(err, fs.ErrNotExist) {
+			t.Error(p, err)
+		}
+	}
+	seqs, err := (Corpus{}).ReadFiles(NewMarkov(1), []string{filepath.Join(dir, "sub")})
+	if err != nil || !reflect.DeepEqual(seqs, [][]string{{"sub/c.txt"}, {"sub/deep/d.txt"}}) {
+		t.Error(seqs, err)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Index remembers training sequences to detect generated text copying them.
+type Index struct {
+	Seqs  [][]Token
+	pairs map[[2]Token][]position
+}
+
+type position struct{ seq, pos int32 }
+
+// CopyError is returned when every attempt copied more than MaxCopy tokens
+// in a row from a training sequence.
+type CopyError struct {
+	Span []string // longest copied span of the last attempt
+}
+
+func (e *CopyError) Error() string {
+	return fmt.Sprintf("markov: %d tokens copied from training text: %s", len(e.Span), strings.Join(e.Span, " "))
+}
+
+func NewIndex() *Index { return &Index{} }
+
+func (x *Index) add(seq []Token) {
+	x.Seqs = append(x.Seqs, seq)
+	x.index(len(x.Seqs) - 1)
+}
+
+// index adds the token pairs of a stored sequence to the lookup table.
+func (x *Index) index(i int) {
+	if x.pairs == nil {
+		x.pairs = map[[2]Token][]position{}
+	}
+	seq := x.Seqs[i]
+	for j := 0; j+1 < len(seq); j++ {
+		pair := [2]Token{seq[j], seq[j+1]}
+		x.pairs[pair] = append(x.pairs[pair], position{int32(i), int32(j)})
+	}
+}
+
+// Longest returns the start and length of the longest span of tokens that
+// also appears in one of the training sequences.
+func (x *Index) Longest(tokens []Token) (start, n int) {
+	for i := 0; i+n < len(tokens); i++ {
+		if tokens[i] != None && n == 0 {
+			start, n = i, 1
+		}
+		if i+1 == len(tokens) {
+			break
+		}
+		for _, p := range x.pairs[[2]Token{tokens[i], tokens[i+1]}] {
+			seq := x.Seqs[p.seq][p.pos:]
+			k := 2
+			for i+k < len(tokens) && k < len(seq) && seq[k] == tokens[i+k] {
+				k++
+			}
+			if k > n {
+				start, n = i, k
+			}
+		}
+	}
+	return start, n
+}
+
+// Copied returns the longest span of words that also appears in a training
+// sequence, or nil if the model has no Index.
+func (m *Model[T]) Copied(words []T) []T {
+	if m.Index == nil {
+		return nil
+	}
+	start, n := m.Index.Longest(m.tokens(words))
+	return words[start : start+n]
+}
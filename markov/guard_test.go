@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestIndex(t *testing.T) {
+	m := NewMarkov(1)
+	m.Index = NewIndex()
+	m.Add(strings.Fields("the cat sat on the mat"))
+	m.Add(strings.Fields("the dog sat on the log"))
+	for _, test := range []struct{ Text, Span string }{
+		{"", ""},
+		{"zebra", ""},
+		{"a zebra cat", "cat"},
+		{"the dog sat on the mat", "the dog sat on the"},
+		{"a cat sat on the mat", "cat sat on the mat"},
+	} {
+		if span := strings.Join(m.Copied(strings.Fields(test.Text)), " "); span != test.Span {
+			t.Error(test.Text, span)
+		}
+	}
+
+	var b bytes.Buffer
+	if err := m.Save(&b); err != nil {
+		t.Fatal(err)
+	}
+	loaded := NewMarkov(1)
+	if err := loaded.Load(&b); err != nil {
+		t.Fatal(err)
+	}
+	if span := loaded.Copied(strings.Fields("the dog sat on the mat")); len(span) != 5 {
+		t.Error(span)
+	}
+
+	m.RNG = rand.New(rand.NewSource(1)).Intn
+	for i := 0; i < 20; i++ {
+		s, err := m.GenerateWith(GenerateOptions{MaxCopy: 3, Retries: 100})
+		if err != nil || len(m.Copied(strings.Fields(s))) > 3 {
+			t.Fatal(s, err)
+		}
+	}
+	var copyErr *CopyError
+	if _, err := m.GenerateWith(GenerateOptions{MaxCopy: 1, Retries: 3}); !errors.As(err, &copyErr) || len(copyErr.Span) < 2 {
+		t.Error(err)
+	}
+	// Without an Index nothing could be checked
+	m.Index = nil
+	if s, err := m.GenerateWith(GenerateOptions{MaxCopy: 3}); err != ErrNoIndex {
+		t.Error(s, err)
+	}
+}
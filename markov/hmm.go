@@ -0,0 +1,376 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"slices"
+	"sort"
+)
+
+var ErrTags = errors.New("markov: tags do not match the sequence")
+
+// HMM is a hidden Markov model: a chain of hidden states, each of which
+// emits an observed symbol. Probabilities of symbols are indexed by their
+// tokens in Vocab, None stands for symbols that were never seen.
+type HMM[T comparable] struct {
+	States []string
+	Start  []float64   // probability of the first state
+	Trans  [][]float64 // probability of the next state after a state
+	Emit   [][]float64 // probability of a token in a state
+	Vocab  *Vocab[T]
+	K      float64 // added to every count when estimating probabilities
+	RNG    func(int) int
+}
+
+// NewHMM returns a model with the given states and uniform probabilities.
+func NewHMM[T comparable](states ...string) *HMM[T] {
+	h := &HMM[T]{Vocab: NewVocab[T](), K: 0.1, RNG: rand.Intn}
+	for _, s := range states {
+		h.state(s)
+	}
+	return h
+}
+
+// state returns the index of a state, adding it if needed, which resets
+// the probabilities of states to uniform ones.
+func (h *HMM[T]) state(name string) int {
+	if i := slices.Index(h.States, name); i >= 0 {
+		return i
+	}
+	h.States = append(h.States, name)
+	n := len(h.States)
+	h.Start = uniform(n)
+	for i := range h.Trans {
+		h.Trans[i] = uniform(n)
+	}
+	h.Trans = append(h.Trans, uniform(n))
+	emit := make([]float64, len(h.Vocab.Words))
+	emit[None] = 1
+	h.Emit = append(h.Emit, emit)
+	return n - 1
+}
+
+func uniform(n int) []float64 {
+	p := make([]float64, n)
+	for i := range p {
+		p[i] = 1 / float64(n)
+	}
+	return p
+}
+
+// normalize scales p to sum up to one, unless it is all zeros.
+func normalize(p []float64) []float64 {
+	sum := 0.0
+	for _, x := range p {
+		sum += x
+	}
+	if sum > 0 {
+		for i := range p {
+			p[i] /= sum
+		}
+	}
+	return p
+}
+
+// intern adds the symbols of seqs to the vocabulary. New symbols get the
+// probability of unknown ones in every state.
+func (h *HMM[T]) intern(seqs [][]T) {
+	for _, seq := range seqs {
+		for _, w := range seq {
+			h.Vocab.ID(w)
+		}
+	}
+	for i, emit := range h.Emit {
+		for len(emit) < len(h.Vocab.Words) {
+			emit = append(emit, emit[None])
+		}
+		h.Emit[i] = normalize(emit)
+	}
+}
+
+func (h *HMM[T]) observe(seq []T) []Token {
+	obs := make([]Token, len(seq))
+	for i, w := range seq {
+		obs[i] = h.Vocab.IDs[w]
+	}
+	return obs
+}
+
+// forward returns the probabilities of the states at every position given
+// the observations up to it, and the probability of each observation given
+// the previous ones, which scales the former.
+func (h *HMM[T]) forward(obs []Token) (alpha [][]float64, scale []float64) {
+	alpha, scale = make([][]float64, len(obs)), make([]float64, len(obs))
+	for t, o := range obs {
+		alpha[t] = make([]float64, len(h.States))
+		for j := range h.States {
+			if t == 0 {
+				alpha[t][j] = h.Start[j]
+			} else {
+				for i, a := range alpha[t-1] {
+					alpha[t][j] += a * h.Trans[i][j]
+				}
+			}
+			alpha[t][j] *= h.Emit[j][o]
+		}
+		for _, a := range alpha[t] {
+			scale[t] += a
+		}
+		if scale[t] == 0 {
+			return alpha[:t], scale[:t+1]
+		}
+		for j := range alpha[t] {
+			alpha[t][j] /= scale[t]
+		}
+	}
+	return alpha, scale
+}
+
+// backward returns the probabilities of the observations after every
+// position given the state at it, scaled like forward.
+func (h *HMM[T]) backward(obs []Token, scale []float64) [][]float64 {
+	beta := make([][]float64, len(obs))
+	for t := len(obs) - 1; t >= 0; t-- {
+		beta[t] = make([]float64, len(h.States))
+		for i := range h.States {
+			if t == len(obs)-1 {
+				beta[t][i] = 1
+				continue
+			}
+			for j, b := range beta[t+1] {
+				beta[t][i] += h.Trans[i][j] * h.Emit[j][obs[t+1]] * b
+			}
+			beta[t][i] /= scale[t+1]
+		}
+	}
+	return beta
+}
+
+// LogProb returns the natural logarithm of the probability of a sequence,
+// summed over all paths through the states.
+func (h *HMM[T]) LogProb(seq []T) float64 {
+	_, scale := h.forward(h.observe(seq))
+	lp := 0.0
+	for _, c := range scale {
+		lp += math.Log(c)
+	}
+	return lp
+}
+
+// Posterior returns the probabilities of the states at every position of a
+// sequence, computed with the forward-backward algorithm. It returns nil
+// if the sequence is impossible.
+func (h *HMM[T]) Posterior(seq []T) [][]float64 {
+	obs := h.observe(seq)
+	alpha, scale := h.forward(obs)
+	if len(alpha) < len(obs) {
+		return nil
+	}
+	beta := h.backward(obs, scale)
+	for t := range alpha {
+		for i := range alpha[t] {
+			alpha[t][i] *= beta[t][i]
+		}
+	}
+	return alpha
+}
+
+// Viterbi returns the most likely states of a sequence and the natural
+// logarithm of the joint probability of the states and the sequence. A
+// model without states returns no states and an impossible sequence.
+func (h *HMM[T]) Viterbi(seq []T) ([]int, float64) {
+	if len(seq) == 0 {
+		return nil, 0
+	}
+	if len(h.States) == 0 {
+		return nil, math.Inf(-1)
+	}
+	obs := h.observe(seq)
+	lp := make([]float64, len(h.States))
+	for i := range lp {
+		lp[i] = math.Log(h.Start[i]) + math.Log(h.Emit[i][obs[0]])
+	}
+	back := make([][]int, len(obs))
+	for t := 1; t < len(obs); t++ {
+		back[t] = make([]int, len(h.States))
+		next := make([]float64, len(h.States))
+		for j := range next {
+			next[j] = math.Inf(-1)
+			for i, p := range lp {
+				if p += math.Log(h.Trans[i][j]); p > next[j] {
+					next[j], back[t][j] = p, i
+				}
+			}
+			next[j] += math.Log(h.Emit[j][obs[t]])
+		}
+		lp = next
+	}
+	path := make([]int, len(obs))
+	for i, p := range lp {
+		if p > lp[path[len(obs)-1]] {
+			path[len(obs)-1] = i
+		}
+	}
+	best := lp[path[len(obs)-1]]
+	for t := len(obs) - 1; t > 0; t-- {
+		path[t-1] = back[t][path[t]]
+	}
+	return path, best
+}
+
+// Tag returns the names of the most likely states of a sequence.
+func (h *HMM[T]) Tag(seq []T) []string {
+	path, _ := h.Viterbi(seq)
+	tags := make([]string, len(path))
+	for t, i := range path {
+		tags[t] = h.States[i]
+	}
+	return tags
+}
+
+// Fit sets the probabilities to the ones estimated from sequences labeled
+// with the names of their states, adding new states and symbols. Every
+// count is increased by K, which leaves some probability for unknown
+// symbols.
+func (h *HMM[T]) Fit(seqs [][]T, tags [][]string) error {
+	if len(seqs) != len(tags) {
+		return ErrTags
+	}
+	states := make([][]int, len(tags))
+	for n, seq := range seqs {
+		if len(seq) != len(tags[n]) {
+			return ErrTags
+		}
+		for _, tag := range tags[n] {
+			states[n] = append(states[n], h.state(tag))
+		}
+	}
+	h.intern(seqs)
+	c := h.counts()
+	for n, seq := range seqs {
+		for t, o := range h.observe(seq) {
+			i := states[n][t]
+			if t == 0 {
+				c.start[i]++
+			} else {
+				c.trans[states[n][t-1]][i]++
+			}
+			c.emit[i][o]++
+		}
+	}
+	h.estimate(c)
+	return nil
+}
+
+// BaumWelch estimates the probabilities from unlabeled sequences with the
+// expectation-maximization algorithm and returns the log probability of
+// the sequences before each iteration. A model without known symbols
+// starts from random probabilities, other models are refined, for example
+// after Fit on a small labeled sample.
+func (h *HMM[T]) BaumWelch(seqs [][]T, iterations int) []float64 {
+	untrained := len(h.Vocab.Words) == int(EOS)+1
+	h.intern(seqs)
+	if untrained {
+		for i := range h.States {
+			for j := range h.Trans[i] {
+				h.Trans[i][j] = float64(1 + h.RNG(1000))
+			}
+			normalize(h.Trans[i])
+			for w := int(EOS) + 1; w < len(h.Emit[i]); w++ {
+				h.Emit[i][w] = float64(1 + h.RNG(1000))
+			}
+			h.Emit[i][None] = 0
+			normalize(h.Emit[i])
+		}
+	}
+	obs := h.tokens(seqs)
+	var logProbs []float64
+	for it := 0; it < iterations; it++ {
+		c, lp := h.counts(), 0.0
+		for _, seq := range obs {
+			alpha, scale := h.forward(seq)
+			for _, s := range scale {
+				lp += math.Log(s)
+			}
+			if len(alpha) < len(seq) {
+				continue
+			}
+			beta := h.backward(seq, scale)
+			for t, o := range seq {
+				for i := range h.States {
+					gamma := alpha[t][i] * beta[t][i]
+					if t == 0 {
+						c.start[i] += gamma
+					}
+					c.emit[i][o] += gamma
+					if t+1 < len(seq) {
+						for j := range h.States {
+							c.trans[i][j] += alpha[t][i] * h.Trans[i][j] * h.Emit[j][seq[t+1]] * beta[t+1][j] / scale[t+1]
+						}
+					}
+				}
+			}
+		}
+		logProbs = append(logProbs, lp)
+		h.estimate(c)
+	}
+	return logProbs
+}
+
+func (h *HMM[T]) tokens(seqs [][]T) [][]Token {
+	obs := make([][]Token, 0, len(seqs))
+	for _, seq := range seqs {
+		if len(seq) > 0 {
+			obs = append(obs, h.observe(seq))
+		}
+	}
+	return obs
+}
+
+// hmmCounts are the expected counts of states, transitions and emissions.
+type hmmCounts struct {
+	start []float64
+	trans [][]float64
+	emit  [][]float64
+}
+
+func (h *HMM[T]) counts() hmmCounts {
+	c := hmmCounts{start: make([]float64, len(h.States))}
+	for range h.States {
+		c.trans = append(c.trans, make([]float64, len(h.States)))
+		c.emit = append(c.emit, make([]float64, len(h.Vocab.Words)))
+	}
+	return c
+}
+
+// estimate sets the probabilities to the counts increased by K. Unknown
+// symbols get K, the reserved BOS and EOS tokens get nothing.
+func (h *HMM[T]) estimate(c hmmCounts) {
+	for i := range c.start {
+		c.start[i] += h.K
+	}
+	h.Start = normalize(c.start)
+	for i := range h.States {
+		for j := range c.trans[i] {
+			c.trans[i][j] += h.K
+		}
+		h.Trans[i] = normalize(c.trans[i])
+		c.emit[i][None] = h.K
+		for w := int(EOS) + 1; w < len(c.emit[i]); w++ {
+			c.emit[i][w] += h.K
+		}
+		h.Emit[i] = normalize(c.emit[i])
+	}
+}
+
+// Top returns the n symbols most likely emitted in a state.
+func (h *HMM[T]) Top(state, n int) []T {
+	ids := make([]Token, 0, len(h.Vocab.Words))
+	for w := range h.Vocab.Words[EOS+1:] {
+		ids = append(ids, EOS+1+Token(w))
+	}
+	emit := h.Emit[state]
+	sort.SliceStable(ids, func(a, b int) bool { return emit[ids[a]] > emit[ids[b]] })
+	return h.Vocab.Symbols(ids[:min(n, len(ids))])
+}
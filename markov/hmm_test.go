@@ -0,0 +1,175 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fever is the example of a doctor guessing whether patients are healthy
+// from how they feel.
+func fever() *HMM[string] {
+	h := NewHMM[string]("healthy", "fever")
+	h.intern([][]string{{"normal", "cold", "dizzy"}})
+	h.Start = []float64{0.6, 0.4}
+	h.Trans = [][]float64{{0.7, 0.3}, {0.4, 0.6}}
+	for i, emit := range [][]float64{{0.5, 0.4, 0.1}, {0.1, 0.3, 0.6}} {
+		h.Emit[i] = make([]float64, len(h.Vocab.Words))
+		copy(h.Emit[i][EOS+1:], emit)
+	}
+	return h
+}
+
+func TestHMM(t *testing.T) {
+	h := fever()
+	seq := []string{"normal", "cold", "dizzy"}
+	// Sum the joint probabilities of all paths
+	total, best := 0.0, 0.0
+	marginal := make([][]float64, len(seq))
+	for i := range marginal {
+		marginal[i] = make([]float64, 2)
+	}
+	for path := 0; path < 8; path++ {
+		p, prev := 1.0, 0
+		for i, w := range seq {
+			s := path >> i & 1
+			if i == 0 {
+				p *= h.Start[s]
+			} else {
+				p *= h.Trans[prev][s]
+			}
+			p *= h.Emit[s][h.Vocab.IDs[w]]
+			prev = s
+		}
+		total += p
+		best = math.Max(best, p)
+		for i := range seq {
+			marginal[i][path>>i&1] += p
+		}
+	}
+	if lp := h.LogProb(seq); math.Abs(lp-math.Log(total)) > 1e-9 {
+		t.Error(lp, math.Log(total))
+	}
+	post := h.Posterior(seq)
+	for i := range seq {
+		for s := range h.States {
+			if math.Abs(post[i][s]-marginal[i][s]/total) > 1e-9 {
+				t.Error(i, s, post[i][s], marginal[i][s]/total)
+			}
+		}
+	}
+	path, lp := h.Viterbi(seq)
+	if !reflect.DeepEqual(path, []int{0, 0, 1}) || math.Abs(lp-math.Log(0.01512)) > 1e-9 || math.Abs(lp-math.Log(best)) > 1e-9 {
+		t.Error(path, math.Exp(lp))
+	}
+	if tags := h.Tag(seq); !reflect.DeepEqual(tags, []string{"healthy", "healthy", "fever"}) {
+		t.Error(tags)
+	}
+	// Unknown symbols are impossible without smoothing
+	if lp := h.LogProb([]string{"normal", "hungry"}); !math.IsInf(lp, -1) || h.Posterior([]string{"hungry"}) != nil {
+		t.Error(lp)
+	}
+	if path, lp := h.Viterbi(nil); path != nil || lp != 0 {
+		t.Error(path, lp)
+	}
+	empty := NewHMM[string]()
+	if path, lp := empty.Viterbi(seq); path != nil || !math.IsInf(lp, -1) || len(empty.Tag(seq)) != 0 {
+		t.Error(path, lp)
+	}
+}
+
+func TestFit(t *testing.T) {
+	h := NewHMM[string]()
+	var seqs, tags [][]string
+	for _, s := range []string{
+		"the/DET dog/NOUN barks/VERB",
+		"a/DET cat/NOUN sleeps/VERB",
+		"the/DET cat/NOUN sees/VERB the/DET dog/NOUN",
+		"dogs/NOUN bark/VERB",
+	} {
+		var words, labels []string
+		for _, pair := range strings.Fields(s) {
+			word, tag, _ := strings.Cut(pair, "/")
+			words, labels = append(words, word), append(labels, tag)
+		}
+		seqs, tags = append(seqs, words), append(tags, labels)
+	}
+	if err := h.Fit(seqs, tags); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(h.States, []string{"DET", "NOUN", "VERB"}) {
+		t.Error(h.States)
+	}
+	for _, test := range []struct {
+		Words string
+		Tags  []string
+	}{
+		{"a dog sees the cat", []string{"DET", "NOUN", "VERB", "DET", "NOUN"}},
+		{"the bird sings", []string{"DET", "NOUN", "VERB"}},
+		{"cats bark", []string{"NOUN", "VERB"}},
+	} {
+		if tags := h.Tag(strings.Fields(test.Words)); !reflect.DeepEqual(tags, test.Tags) {
+			t.Error(test.Words, tags)
+		}
+	}
+	if top := h.Top(0, 2); !reflect.DeepEqual(top, []string{"the", "a"}) {
+		t.Error(top)
+	}
+	if err := h.Fit(seqs, tags[:1]); err != ErrTags {
+		t.Error(err)
+	}
+	if err := h.Fit(seqs[:1], [][]string{{"DET"}}); err != ErrTags {
+		t.Error(err)
+	}
+	// Unlabeled sequences refine the model and keep its states
+	h.BaumWelch([][]string{{"the", "bird", "sings"}, {"a", "bird", "sees", "the", "dog"}}, 3)
+	if tags := h.Tag([]string{"the", "bird", "sings"}); !reflect.DeepEqual(tags, []string{"DET", "NOUN", "VERB"}) {
+		t.Error(tags)
+	}
+}
+
+func TestBaumWelch(t *testing.T) {
+	// Sentences alternate between runs of vowels and consonants
+	rng := rand.New(rand.NewSource(1))
+	var seqs [][]string
+	for n := 0; n < 200; n++ {
+		var seq []string
+		vowel := rng.Intn(2) == 0
+		for i := 0; i < 20; i++ {
+			if rng.Intn(5) == 0 {
+				vowel = !vowel
+			}
+			if vowel {
+				seq = append(seq, string("aeiou"[rng.Intn(5)]))
+			} else {
+				seq = append(seq, string("bcdfg"[rng.Intn(5)]))
+			}
+		}
+		seqs = append(seqs, seq)
+	}
+	// Like any EM, it may get stuck in a local optimum from other seeds
+	h := NewHMM[string]("0", "1")
+	h.RNG = rand.New(rand.NewSource(2)).Intn
+	lps := h.BaumWelch(seqs, 30)
+	if len(lps) != 30 || lps[29] <= lps[0] {
+		t.Fatal(lps)
+	}
+	for i := 1; i < len(lps); i++ {
+		if lps[i] < lps[i-1]-1e-6 {
+			t.Error(i, lps[i-1], lps[i])
+		}
+	}
+	vowels := h.Tag([]string{"a"})[0]
+	for _, seq := range seqs[:20] {
+		for i, tag := range h.Tag(seq) {
+			if strings.Contains("aeiou", seq[i]) != (tag == vowels) {
+				t.Error(seq, i, tag)
+			}
+		}
+	}
+	if p := h.Trans[0][0]; p < 0.7 || p > 0.9 {
+		t.Error(h.Trans)
+	}
+}
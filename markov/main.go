@@ -0,0 +1,633 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+)
+
+func main() {
+	cmd, args := "", os.Args[1:]
+	if len(args) > 0 {
+		cmd = args[0]
+	}
+	switch cmd {
+	case "eval":
+		evaluate(args[1:])
+	case "classify":
+		classify(args[1:])
+	case "merge":
+		merge(args[1:])
+	case "mashup":
+		mashup(args[1:])
+	case "suggest":
+		suggest(args[1:])
+	case "stats":
+		stats(args[1:])
+	case "arpa":
+		arpa(args[1:])
+	case "compress":
+		compress(args[1:])
+	case "decompress":
+		decompress(args[1:])
+	case "hmm":
+		hmm(args[1:])
+	default:
+		generate(args)
+	}
+}
+
+// modelFlags are the flags of every command that trains or loads a model.
+type modelFlags struct {
+	load, arpa, tokens, backoff *string
+	order, budget, halfLife     *int
+	in                          []string
+	corpus                      Corpus
+}
+
+func newModelFlags(fs *flag.FlagSet) *modelFlags {
+	f := &modelFlags{
+		load:     fs.String("load", "", "read a trained model from file instead of training"),
+		arpa:     fs.String("arpa", "", "read an ARPA n-gram model from file instead of training"),
+		tokens:   fs.String("t", "word", "token type to train on: word, char or sentence"),
+		backoff:  fs.String("backoff", "none", "shorter prefix fallback: none, stupid or interp"),
+		order:    fs.Int("order", 2, "number of tokens to predict the next one from"),
+		budget:   fs.Int("budget", 0, "most transitions to keep while training, rarest are pruned first, endings of sentences are always kept, 0 is unlimited"),
+		halfLife: fs.Int("halflife", 0, "halve all counts every N training sequences, 0 is never"),
+	}
+	fs.Func("in", "read text from a file, directory or glob instead of stdin, may be repeated", func(s string) error {
+		f.in = append(f.in, s)
+		return nil
+	})
+	fs.BoolVar(&f.corpus.Gutenberg, "gutenberg", true, "strip Project Gutenberg headers and footers")
+	fs.BoolVar(&f.corpus.Quotes, "quotes", true, "replace typographic quotes with ASCII ones")
+	fs.BoolVar(&f.corpus.Lower, "lower", false, "fold text to lower case")
+	return f
+}
+
+// read returns the sequences of the -in files, or of stdin if there are
+// none, split by m.
+func (f *modelFlags) read(m *Markov) [][]string {
+	var seqs [][]string
+	var err error
+	if len(f.in) > 0 {
+		seqs, err = f.corpus.ReadFiles(m, f.in)
+	} else if seqs, err = f.corpus.Read(m, os.Stdin); err != nil {
+		err = fmt.Errorf("stdin: %w", err)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	return seqs
+}
+
+// model returns an untrained model configured by the flags, or the loaded one.
+func (f *modelFlags) model() *Markov {
+	if *f.order < 1 || *f.order > MaxOrder {
+		log.Fatalf("order must be within 1..%d", MaxOrder)
+	}
+	markov := NewMarkov(*f.order)
+	switch *f.tokens {
+	case "word":
+		markov.Mode = Words
+	case "char":
+		markov.Mode = Chars
+	case "sentence":
+		markov.Mode = Sentences
+	default:
+		log.Fatal("unknown token type: ", *f.tokens)
+	}
+	switch *f.backoff {
+	case "none":
+		markov.Backoff = NoBackoff
+	case "stupid":
+		markov.Backoff = StupidBackoff
+	case "interp":
+		markov.Backoff = Interpolated
+	default:
+		log.Fatal("unknown backoff: ", *f.backoff)
+	}
+	markov.Budget, markov.HalfLife = *f.budget, *f.halfLife
+	if *f.load != "" {
+		loadModel(markov, *f.load)
+	}
+	if *f.arpa != "" {
+		file, err := os.Open(*f.arpa)
+		if err != nil {
+			log.Fatal(err)
+		}
+		imported, err := ReadARPA(file)
+		file.Close()
+		if err != nil {
+			log.Fatal(*f.arpa, ": ", err)
+		}
+		imported.Mode, imported.RNG = markov.Mode, markov.RNG
+		markov = imported
+	}
+	return markov
+}
+
+// loaded reports if the model is read from a file rather than trained.
+func (f *modelFlags) loaded() bool {
+	return *f.load != "" || *f.arpa != ""
+}
+
+func loadModel(m *Markov, path string) {
+	f, err := os.Open(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	if err := m.Load(f); err != nil {
+		log.Fatal(path, ": ", err)
+	}
+}
+
+func saveModel(m *Markov, path string) {
+	f, err := os.Create(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := m.Save(f); err != nil {
+		log.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func generate(args []string) {
+	fs := flag.NewFlagSet("markov", flag.ExitOnError)
+	mf := newModelFlags(fs)
+	save := fs.String("save", "", "train and write the model to file")
+	n := fs.Int("n", 1, "number of sequences to generate")
+	seed := fs.Int64("seed", 0, "random seed, 0 picks one at random")
+	var opts GenerateOptions
+	fs.Float64Var(&opts.Temperature, "temp", 1, "sampling temperature")
+	fs.IntVar(&opts.TopK, "topk", 0, "sample from the K most likely tokens only, 0 means all")
+	fs.Float64Var(&opts.TopP, "topp", 0, "sample from the most likely tokens covering P of the mass, 0 means all")
+	fs.BoolVar(&opts.Greedy, "greedy", false, "always take the most likely token")
+	fs.IntVar(&opts.MaxCopy, "maxcopy", 0, "resample output copying more than N tokens in a row from the training text")
+	fs.IntVar(&opts.MinTokens, "min", 0, "resample output shorter than N tokens")
+	fs.IntVar(&opts.MaxTokens, "max", 0, "resample output longer than N tokens, 0 means no limit; with -beam, the longest output, 0 means 50 tokens after the prompt")
+	fs.BoolVar(&opts.End, "end", false, "resample output not ending with terminal punctuation")
+	fs.BoolVar(&opts.NoCycles, "nocycles", false, "resample output repeating itself")
+	fs.IntVar(&opts.Retries, "retries", 10, "number of times rejected output is resampled")
+	anchor := fs.String("anchor", "", "generate a sequence containing these words")
+	backward := fs.Bool("backward", false, "also train a backward chain, implied by -anchor")
+	workers := fs.Int("workers", 1, "number of goroutines to train with, -budget and -halflife apply to each of them")
+	beam := fs.Int("beam", 0, "print the N most probable sequences instead of sampling")
+	width := fs.Int("width", 20, "beam width")
+	fs.Parse(args)
+
+	if *workers < 1 {
+		log.Fatal("workers must be at least 1")
+	}
+
+	markov := mf.model()
+	if !mf.loaded() {
+		seqs := make(chan []string, 1024)
+		go func() {
+			for _, seq := range mf.read(markov) {
+				seqs <- seq
+			}
+			close(seqs)
+		}()
+		markov = Train(func() *Markov {
+			m := mf.model()
+			if opts.MaxCopy > 0 {
+				m.Index = NewIndex()
+			}
+			if *backward || *anchor != "" {
+				m.Backward = map[NGram]*Transitions{}
+			}
+			return m
+		}, seqs, *workers)
+	}
+	if *save != "" {
+		saveModel(markov, *save)
+		return
+	}
+	if opts.MaxCopy > 0 && markov.Index == nil {
+		log.Fatal("-maxcopy needs a model saved with -maxcopy: ", ErrNoIndex)
+	}
+	if *seed != 0 {
+		markov.RNG = rand.New(rand.NewSource(*seed)).Intn
+	}
+	if prompt := fs.Args(); len(prompt) > 0 {
+		opts.Prompt = markov.Split(strings.Join(prompt, " "))
+	}
+	if *anchor != "" {
+		opts.Anchor = markov.Split(*anchor)
+	}
+	if *beam > 0 {
+		maxLen := 50
+		if opts.MaxTokens > 0 {
+			maxLen = max(0, opts.MaxTokens-len(opts.Prompt))
+		}
+		for _, h := range markov.Beam(opts.Prompt, *width, *beam, maxLen) {
+			fmt.Printf("%.2f\t%s\n", h.LogProb, h.Text)
+		}
+		return
+	}
+	for i := 0; i < *n; i++ {
+		s, err := markov.GenerateWith(opts)
+		fmt.Println(s)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if opts.MaxCopy > 0 {
+			span := markov.Copied(markov.Split(s))
+			fmt.Fprintf(os.Stderr, "longest copied span: %d tokens: %s\n", len(span), markov.Join(span))
+		}
+	}
+}
+
+// evaluate reports the perplexity of held-out text. With -load all of the
+// text is held out, otherwise the model is trained on its beginning and
+// evaluated on the rest.
+func evaluate(args []string) {
+	fs := flag.NewFlagSet("markov eval", flag.ExitOnError)
+	mf := newModelFlags(fs)
+	holdout := fs.Float64("holdout", 0.1, "fraction of the text to evaluate on when training")
+	smoothing := fs.String("smoothing", "", "smoothing: kn or addk, default kn or the probabilities of the -arpa file")
+	k := fs.Float64("k", 1, "add-k count")
+	d := fs.Float64("d", 0.75, "Kneser-Ney discount")
+	fs.Parse(args)
+
+	markov := mf.model()
+	if *smoothing == "" && *mf.arpa == "" {
+		*smoothing = "kn"
+	}
+	switch *smoothing {
+	case "":
+	case "kn":
+		markov.Smoothing = KneserNey{D: *d}
+	case "addk":
+		markov.Smoothing = AddK{K: *k}
+	default:
+		log.Fatal("unknown smoothing: ", *smoothing)
+	}
+	var test [][]string
+	for _, seq := range mf.read(markov) {
+		if len(seq) > 0 {
+			test = append(test, seq)
+		}
+	}
+	if !mf.loaded() {
+		n := int(float64(len(test)) * (1 - *holdout))
+		for _, seq := range test[:n] {
+			markov.Add(seq)
+		}
+		test = test[n:]
+	}
+	if len(test) == 0 {
+		log.Fatal("no sequences to evaluate")
+	}
+	fmt.Printf("sequences: %d\nperplexity: %.2f\n", len(test), markov.Perplexity(test))
+}
+
+// classify trains a model for each directory, labeled with the directory
+// name, and reports how held-out sequences of every label are classified.
+func classify(args []string) {
+	fs := flag.NewFlagSet("markov classify", flag.ExitOnError)
+	mf := newModelFlags(fs)
+	holdout := fs.Float64("holdout", 0.1, "fraction of every label's sequences to test on")
+	fs.Parse(args)
+	if mf.loaded() {
+		log.Fatal("classify trains a model per label, -load and -arpa are not supported")
+	}
+
+	c := NewClassifier(mf.model)
+	test := map[string][][]string{}
+	for _, dir := range fs.Args() {
+		label := filepath.Base(dir)
+		all, err := mf.corpus.ReadFiles(c.New(), []string{dir})
+		if err != nil {
+			log.Fatal(err)
+		}
+		var seqs [][]string
+		for _, seq := range all {
+			if len(seq) > 0 {
+				seqs = append(seqs, seq)
+			}
+		}
+		n := int(float64(len(seqs)) * (1 - *holdout))
+		if n == 0 {
+			log.Fatalf("%s: no sequences to train on", dir)
+		}
+		for _, seq := range seqs[:n] {
+			c.Add(label, seq)
+		}
+		test[label] = seqs[n:]
+	}
+
+	conf := Confusion{}
+	for _, label := range c.Labels {
+		for _, seq := range test[label] {
+			predicted, _ := c.Classify(seq)
+			conf.Add(label, predicted)
+		}
+	}
+	fmt.Printf("accuracy: %.4f\n\n", conf.Accuracy())
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprint(w, "actual \\ predicted\t")
+	for _, label := range c.Labels {
+		fmt.Fprint(w, label, "\t")
+	}
+	fmt.Fprintln(w)
+	for _, actual := range c.Labels {
+		fmt.Fprint(w, actual, "\t")
+		for _, predicted := range c.Labels {
+			fmt.Fprint(w, conf[actual][predicted], "\t")
+		}
+		fmt.Fprintln(w)
+	}
+	w.Flush()
+}
+
+// merge blends two saved models into a new one.
+func merge(args []string) {
+	fs := flag.NewFlagSet("markov merge", flag.ExitOnError)
+	weight := fs.Float64("w", 0.5, "weight of the first model, the second one gets 1-w")
+	save := fs.String("save", "merged.model", "file to write the merged model to")
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		log.Fatal("usage: markov merge [-w weight] [-save file] a.model b.model")
+	}
+
+	a, b := NewMarkov(1), NewMarkov(1)
+	loadModel(a, fs.Arg(0))
+	loadModel(b, fs.Arg(1))
+	m, err := Merge(a, b, *weight)
+	if err != nil {
+		log.Fatal(err)
+	}
+	saveModel(m, *save)
+}
+
+// mashup generates from several saved models and shows the model every
+// token came from.
+func mashup(args []string) {
+	fs := flag.NewFlagSet("markov mashup", flag.ExitOnError)
+	weights := fs.String("w", "", "comma-separated model weights, equal by default")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		log.Fatal("usage: markov mashup [-w weights] a.model b.model...")
+	}
+
+	var models []*Markov
+	var names []string
+	for _, path := range fs.Args() {
+		m := NewMarkov(1)
+		loadModel(m, path)
+		models = append(models, m)
+		names = append(names, strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)))
+	}
+	x := NewMashup(models...)
+	if *weights != "" {
+		for i, w := range strings.Split(*weights, ",") {
+			if i >= len(x.Weights) {
+				log.Fatal("bad weights: ", *weights)
+			}
+			if _, err := fmt.Sscan(w, &x.Weights[i]); err != nil || !(x.Weights[i] >= 0) {
+				log.Fatal("bad weights: ", *weights)
+			}
+		}
+	}
+	tokens, sources := x.Generate()
+	fmt.Println(models[0].Join(tokens))
+	for i, t := range tokens {
+		fmt.Printf("%s[%s] ", t, names[sources[i]])
+	}
+	fmt.Println()
+}
+
+// suggest reads partial lines from stdin and prints the most likely next
+// words. A line not ending with a space ends with an incomplete word, and
+// only the words starting with it are suggested.
+func suggest(args []string) {
+	fs := flag.NewFlagSet("markov suggest", flag.ExitOnError)
+	mf := newModelFlags(fs)
+	k := fs.Int("k", 5, "number of suggestions")
+	fs.Parse(args)
+
+	markov := mf.model()
+	if !mf.loaded() {
+		if len(mf.in) == 0 {
+			log.Fatal("usage: markov suggest [-k n] -load file | -in corpus...")
+		}
+		for _, seq := range mf.read(markov) {
+			markov.Add(seq)
+		}
+	}
+	scanner := bufio.NewScanner(os.Stdin)
+	for fmt.Print("> "); scanner.Scan(); fmt.Print("> ") {
+		line := scanner.Text()
+		context, partial := markov.Split(line), ""
+		if markov.Mode != Chars && len(context) > 0 && !strings.HasSuffix(line, " ") {
+			context, partial = context[:len(context)-1], context[len(context)-1]
+		}
+		n := 0
+		for _, s := range markov.Suggest(context, 0) {
+			if n == *k {
+				break
+			}
+			if strings.HasPrefix(s.Word, partial) {
+				fmt.Printf("%.4f\t%s\n", s.Prob, s.Word)
+				n++
+			}
+		}
+	}
+	fmt.Println()
+}
+
+// stats describes a model trained on stdin or loaded, or writes a Graphviz
+// graph of the states around a prefix.
+func stats(args []string) {
+	fs := flag.NewFlagSet("markov stats", flag.ExitOnError)
+	mf := newModelFlags(fs)
+	top := fs.Int("top", 10, "number of most frequent transitions to show")
+	dot := fs.Bool("dot", false, "write a Graphviz graph around the prefix given as arguments instead")
+	depth := fs.Int("depth", 2, "graph depth in transitions")
+	width := fs.Int("width", 5, "most frequent next words to follow from every state")
+	fs.Parse(args)
+
+	markov := mf.model()
+	if !mf.loaded() {
+		for _, seq := range mf.read(markov) {
+			markov.Add(seq)
+		}
+	}
+	if *dot {
+		prefix := markov.Split(strings.Join(fs.Args(), " "))
+		if err := markov.WriteDOT(os.Stdout, prefix, *depth, *width); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	s := markov.Stats(*top)
+	fmt.Printf("vocabulary: %d\nstates: %d\ntransitions: %d\n", s.Words, s.States, s.Transitions)
+	if s.States > 0 {
+		fmt.Printf("mean branching: %.2f\n", float64(s.Transitions)/float64(s.States))
+	}
+	fmt.Printf("mean entropy: %.2f bits\n", s.MeanEntropy)
+	if e := markov.Evicted; e.Prunes > 0 || e.Decays > 0 {
+		fmt.Printf("evicted: %d transitions, %d states, %d occurrences in %d prunes and %d decays\n",
+			e.Transitions, e.States, e.Count, e.Prunes, e.Decays)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "\nnext words\tstates\t")
+	for lo := 1; lo <= s.Transitions; lo *= 2 {
+		n := 0
+		for b, c := range s.Branching {
+			if b >= lo && b < 2*lo {
+				n += c
+			}
+		}
+		if n > 0 {
+			fmt.Fprintf(w, "%d-%d\t%d\t\n", lo, 2*lo-1, n)
+		}
+	}
+	fmt.Fprintln(w, "\nentropy, bits\tstates\t")
+	maxH := -1
+	for h := range s.Entropy {
+		maxH = max(maxH, h)
+	}
+	for h := 0; h <= maxH; h++ {
+		fmt.Fprintf(w, "%d-%d\t%d\t\n", h, h+1, s.Entropy[h])
+	}
+	fmt.Fprintln(w, "\ncount\ttransition\t")
+	for _, t := range s.Top {
+		fmt.Fprintf(w, "%d\t%s -> %s\t\n", t.Count, strings.Join(t.Prefix, " "), t.Next)
+	}
+	w.Flush()
+}
+
+// arpa writes a model trained on the input, or loaded, in the ARPA format.
+func arpa(args []string) {
+	fs := flag.NewFlagSet("markov arpa", flag.ExitOnError)
+	mf := newModelFlags(fs)
+	fs.Parse(args)
+
+	markov := mf.model()
+	if !mf.loaded() {
+		for _, seq := range mf.read(markov) {
+			markov.Add(seq)
+		}
+	}
+	if err := markov.WriteARPA(os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// compress codes the standard input with a byte model of the given order.
+func compress(args []string) {
+	fs := flag.NewFlagSet("markov compress", flag.ExitOnError)
+	order := fs.Int("order", 4, "bytes of context")
+	fs.Parse(args)
+
+	if err := Compress(os.Stdout, os.Stdin, *order); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func decompress(args []string) {
+	fs := flag.NewFlagSet("markov decompress", flag.ExitOnError)
+	fs.Parse(args)
+
+	if err := Decompress(os.Stdout, os.Stdin); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// hmm learns word classes from the input with Baum-Welch and prints the
+// most likely words of every class. With -tagged it trains on a labeled
+// sample instead, refined on the -in files if any, and tags stdin.
+func hmm(args []string) {
+	fs := flag.NewFlagSet("markov hmm", flag.ExitOnError)
+	mf := newModelFlags(fs)
+	states := fs.Int("states", 8, "number of hidden states to learn")
+	iterations := fs.Int("iter", 20, "Baum-Welch iterations")
+	top := fs.Int("top", 10, "words to print for every state")
+	tagged := fs.String("tagged", "", "train on a file of word/TAG tokens and tag the lines of stdin")
+	seed := fs.Int64("seed", 0, "random seed, 0 picks one at random")
+	fs.Parse(args)
+	if mf.loaded() {
+		log.Fatal("hmm trains its own model, -load and -arpa are not supported")
+	}
+
+	markov := mf.model()
+	h := NewHMM[string]()
+	if *seed != 0 {
+		h.RNG = rand.New(rand.NewSource(*seed)).Intn
+	}
+	train := func(seqs [][]string) {
+		for i, lp := range h.BaumWelch(seqs, *iterations) {
+			fmt.Fprintf(os.Stderr, "iteration %d: log probability %.1f\n", i+1, lp)
+		}
+	}
+	if *tagged == "" {
+		for i := 0; i < *states; i++ {
+			h.state(fmt.Sprint(i))
+		}
+		train(mf.read(markov))
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for i, name := range h.States {
+			fmt.Fprintf(w, "%s\t%s\n", name, strings.Join(h.Top(i, *top), " "))
+		}
+		w.Flush()
+		return
+	}
+
+	seqs, tags := readTagged(*tagged)
+	if err := h.Fit(seqs, tags); err != nil {
+		log.Fatal(*tagged, ": ", err)
+	}
+	if len(h.States) == 0 {
+		log.Fatal(*tagged, ": no tagged words")
+	}
+	if len(mf.in) > 0 {
+		train(mf.read(markov))
+	}
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		words := markov.Split(scanner.Text())
+		for i, tag := range h.Tag(words) {
+			words[i] += "/" + tag
+		}
+		fmt.Println(strings.Join(words, " "))
+	}
+}
+
+// readTagged returns the words and tags of a file where every line is a
+// sequence of word/TAG tokens.
+func readTagged(path string) (seqs, tags [][]string) {
+	f, err := os.Open(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		var words, labels []string
+		for _, token := range strings.Fields(scanner.Text()) {
+			i := strings.LastIndex(token, "/")
+			if i <= 0 || i == len(token)-1 {
+				log.Fatalf("%s:%d: %q is not a word/TAG token", path, line, token)
+			}
+			words, labels = append(words, token[:i]), append(labels, token[i+1:])
+		}
+		seqs, tags = append(seqs, words), append(tags, labels)
+	}
+	if err := scanner.Err(); err != nil {
+		log.Fatal(path, ": ", err)
+	}
+	return seqs, tags
+}
@@ -2,60 +2,610 @@ package main
 
 import (
 	"bufio"
+	"encoding/gob"
+	"errors"
 	"fmt"
+	"io"
 	"math/rand"
-	"os"
+	"slices"
+	"sort"
 	"strings"
 )
 
+// FormatVersion is written in the header of every saved model. Bump it
+// whenever the encoded fields change.
+const FormatVersion = 8
+
+// MaxOrder is the longest prefix an NGram key can hold.
+const MaxOrder = 8
+
+var (
+	ErrFormat   = errors.New("markov: unsupported model format")
+	ErrTooShort = errors.New("markov: sequence is too short")
+	ErrTooLong  = errors.New("markov: sequence is too long")
+	ErrNoEnd    = errors.New("markov: sequence does not end with terminal punctuation")
+	ErrCycle    = errors.New("markov: sequence repeats itself")
+	ErrBackward = errors.New("markov: model has no backward chain")
+	ErrNoIndex  = errors.New("markov: model has no index of training sequences")
+	ErrAnchor   = errors.New("markov: anchor was never seen")
+	ErrUnknown  = errors.New("markov: prefix was never seen")
+)
+
+// Token is an interned word, an index into Vocab.Words.
+type Token int32
+
+// NGram is a fixed-size prefix key, unused trailing slots are zero. Shorter
+// keys hold the last tokens of a longer prefix.
+type NGram [MaxOrder]Token
+
+// Reserved tokens: None fills unused NGram slots, BOS pads the beginning of
+// every sequence and EOS marks its end.
+const (
+	None Token = iota
+	BOS
+	EOS
+)
+
+// Vocab interns words, which may be any comparable symbols. The first
+// tokens are reserved, see BOS and EOS.
+type Vocab[T comparable] struct {
+	Words []T
+	IDs   map[T]Token
+}
+
+// Mode selects what a single token of the chain is.
+type Mode int
+
+const (
+	Words     Mode = iota // whitespace-separated words
+	Chars                 // single runes
+	Sentences             // words and punctuation of sentences spanning lines
+)
+
+// Backoff selects how shorter prefixes contribute to sampling.
+type Backoff int
+
+const (
+	NoBackoff     Backoff = iota // only prefixes of length Order are trained
+	StupidBackoff                // words unseen after a prefix are discounted by Alpha per shorter prefix
+	Interpolated                 // prefixes of every length are mixed with Lambda weights
+)
+
+// Model is a Markov chain over sequences of any comparable symbols, such as
+// notes, events or IDs.
+type Model[T comparable] struct {
+	Order     int
+	Backoff   Backoff   // must be set before training
+	Alpha     float64   // stupid backoff discount
+	Lambda    []float64 // interpolation weights by prefix length, 1 if missing
+	Smoothing Smoothing // used for scoring, not saved
+	Index     *Index    // training sequences, kept if not nil before training
+	Vocab     *Vocab[T]
+	Chain     map[NGram]*Transitions
+	Backward  map[NGram]*Transitions // reversed sequences, trained if not nil before training
+	RNG       func(int) int
+	Budget    int       // transitions kept by Add besides those to EOS, see Prune, 0 is unlimited, not saved
+	HalfLife  int       // sequences after which Add halves all counts, see Decay, 0 is never, not saved
+	Evicted   Evictions // what Prune and Decay removed
+	kn        *knStats
+	edges     int // transitions in Chain and Backward that Prune may remove
+	added     int // sequences since the last Decay by Add
+}
+
+// Markov is a model of text, split into string tokens according to Mode.
 type Markov struct {
-	Order int
-	Chain map[string][]string
-	Start []string
-	RNG   func(int) int
+	*Model[string]
+	Mode Mode
+}
+
+// Transitions counts the successors of a prefix, in order of first appearance.
+type Transitions struct {
+	Next  []Token
+	Count []int
+	Total int
+	index map[Token]int
+	cum   []int // cumulative counts of a frozen model
+}
+
+type model struct {
+	Order    int
+	Mode     Mode
+	Backoff  Backoff
+	Alpha    float64
+	Lambda   []float64
+	Words    []string
+	Chain    map[NGram]*Transitions
+	Backward map[NGram]*Transitions
+	Index    *Index
+}
+
+// NewVocab returns a vocabulary of words. The reserved tokens are zero
+// values and are not interned, so any symbol can be a word.
+func NewVocab[T comparable](words ...T) *Vocab[T] {
+	v := &Vocab[T]{Words: make([]T, EOS+1), IDs: map[T]Token{}}
+	for _, w := range words {
+		v.ID(w)
+	}
+	return v
+}
+
+// newWords returns a vocabulary of strings where BOS and EOS are printed
+// as "<s>" and "</s>". Like other reserved tokens they are not interned,
+// so the text may contain these words.
+func newWords(words ...string) *Vocab[string] {
+	v := NewVocab[string]()
+	v.Words[BOS], v.Words[EOS] = "<s>", "</s>"
+	for _, w := range words {
+		v.ID(w)
+	}
+	return v
+}
+
+// ID returns the token for w, interning it if needed.
+func (v *Vocab[T]) ID(w T) Token {
+	id, ok := v.IDs[w]
+	if !ok {
+		id = Token(len(v.Words))
+		v.IDs[w] = id
+		v.Words = append(v.Words, w)
+	}
+	return id
+}
+
+func (v *Vocab[T]) Symbols(tokens []Token) []T {
+	words := make([]T, len(tokens))
+	for i, id := range tokens {
+		words[i] = v.Words[id]
+	}
+	return words
+}
+
+func NewModel[T comparable](order int) *Model[T] {
+	if order < 1 || order > MaxOrder {
+		panic(fmt.Sprintf("markov: order must be within 1..%d", MaxOrder))
+	}
+	return &Model[T]{
+		Order:     order,
+		Alpha:     0.4,
+		Smoothing: KneserNey{D: 0.75},
+		Vocab:     NewVocab[T](),
+		Chain:     map[NGram]*Transitions{},
+		RNG:       rand.Intn,
+	}
 }
 
 func NewMarkov(order int) *Markov {
-	return &Markov{Order: order, Chain: map[string][]string{}, RNG: rand.Intn}
+	m := &Markov{Model: NewModel[string](order)}
+	m.Vocab = newWords()
+	return m
 }
 
-func (m *Markov) Add(input []string) {
-	if len(input) < m.Order {
+// find returns the position of w in Next, or -1. Short lists are scanned,
+// long ones get an index.
+func (t *Transitions) find(w Token) int {
+	if len(t.Next) <= 8 {
+		return slices.Index(t.Next, w)
+	}
+	if t.index == nil {
+		t.index = make(map[Token]int, len(t.Next))
+		for i, next := range t.Next {
+			t.index[next] = i
+		}
+	}
+	if i, ok := t.index[w]; ok {
+		return i
+	}
+	return -1
+}
+
+func (t *Transitions) add(next Token, c int) {
+	if i := t.find(next); i >= 0 {
+		t.Count[i] += c
+	} else {
+		if t.index != nil {
+			t.index[next] = len(t.Next)
+		}
+		t.Next = append(t.Next, next)
+		t.Count = append(t.Count, c)
+	}
+	t.Total += c
+	t.cum = nil
+}
+
+// pick returns the successor at cumulative weight r, 0 <= r < Total.
+func (t *Transitions) pick(r int) Token {
+	if t.cum != nil {
+		return t.Next[sort.Search(len(t.cum), func(i int) bool { return t.cum[i] > r })]
+	}
+	for i, c := range t.Count {
+		if r < c {
+			return t.Next[i]
+		}
+		r -= c
+	}
+	return t.Next[len(t.Next)-1]
+}
+
+// Split breaks a line of text into tokens according to the mode.
+func (m *Markov) Split(line string) []string {
+	switch m.Mode {
+	case Chars:
+		return strings.Split(strings.TrimSpace(line), "")
+	case Sentences:
+		return Tokenize(line)
+	}
+	return strings.Fields(line)
+}
+
+// Join glues tokens back into text according to the mode.
+func (m *Markov) Join(tokens []string) string {
+	switch m.Mode {
+	case Chars:
+		return strings.Join(tokens, "")
+	case Sentences:
+		return Detokenize(tokens)
+	}
+	return strings.TrimSpace(strings.Join(tokens, " "))
+}
+
+// lookup returns the key for a prefix of known words.
+func (m *Model[T]) lookup(words []T) (key NGram, ok bool) {
+	for i, w := range words {
+		if key[i], ok = m.Vocab.IDs[w]; !ok {
+			return key, false
+		}
+	}
+	return key, true
+}
+
+// start returns the key of the beginning of a sequence.
+func (m *Model[T]) start() (key NGram) {
+	for i := 0; i < m.Order; i++ {
+		key[i] = BOS
+	}
+	return key
+}
+
+// suffix returns the key made of the last n tokens of a full-length key.
+func (m *Model[T]) suffix(key NGram, n int) (k NGram) {
+	copy(k[:n], key[m.Order-n:m.Order])
+	return k
+}
+
+// known reports if the last n tokens of a full-length key are all known words.
+func (m *Model[T]) known(key NGram, n int) bool {
+	return !slices.Contains(key[m.Order-n:m.Order], None)
+}
+
+// follow returns the transitions after the last n tokens of a full-length
+// key, or nil if they were never seen.
+func (m *Model[T]) follow(key NGram, n int) *Transitions {
+	if !m.known(key, n) {
+		return nil
+	}
+	if t := m.Chain[m.suffix(key, n)]; t != nil && t.Total > 0 {
+		return t
+	}
+	return nil
+}
+
+// count adds c occurrences of next after key and reports if the
+// transition is new and may be pruned, which is all but those to EOS.
+func (m *Model[T]) count(key NGram, next Token, c int) bool {
+	t := m.Chain[key]
+	if t == nil {
+		t = &Transitions{}
+		m.Chain[key] = t
+	}
+	n := len(t.Next)
+	t.add(next, c)
+	return len(t.Next) > n && next != EOS
+}
+
+func (m *Model[T]) Add(input []T) {
+	if len(input) == 0 {
 		return
 	}
-	input = append(input, make([]string, m.Order)...) // pad with empty strings
-	m.Start = append(m.Start, strings.Join(input[:m.Order], " "))
-	for i := 0; i < len(input)-m.Order; i++ {
-		prefix := strings.Join(input[i:i+m.Order], " ")
-		m.Chain[prefix] = append(m.Chain[prefix], input[i+m.Order])
+	m.kn = nil
+	tokens := make([]Token, len(input))
+	for i, w := range input {
+		tokens[i] = m.Vocab.ID(w)
+	}
+	if m.Index != nil {
+		m.Index.add(tokens)
+	}
+	m.edges += m.train(tokens)
+	if m.Backward != nil {
+		reversed := slices.Clone(tokens)
+		slices.Reverse(reversed)
+		m.edges += m.backward().train(reversed)
+	}
+	if m.added++; m.HalfLife > 0 && m.added >= m.HalfLife {
+		m.Decay(0.5)
+	}
+	if m.Budget > 0 && m.edges > m.Budget {
+		m.Prune(m.Budget * 9 / 10)
 	}
 }
 
+// train counts the transitions of a sequence and returns how many of them
+// are new and may be pruned.
+func (m *Model[T]) train(tokens []Token) (added int) {
+	key := m.start()
+	for _, next := range append(tokens, EOS) {
+		if m.count(key, next, 1) {
+			added++
+		}
+		if m.Backoff != NoBackoff {
+			for n := 0; n < m.Order; n++ {
+				if m.count(m.suffix(key, n), next, 1) {
+					added++
+				}
+			}
+		}
+		copy(key[:], key[1:m.Order])
+		key[m.Order-1] = next
+	}
+	return added
+}
+
+// Generate samples a sequence from the beginning.
+func (m *Model[T]) Generate() []T {
+	return m.GenerateFrom(nil)
+}
+
+// GenerateFrom continues a sequence beginning with prefix, falling back to
+// shorter endings of the prefix if needed, see Markov.GenerateFrom.
+func (m *Model[T]) GenerateFrom(prefix []T) []T {
+	out, _ := m.walk(m.context(prefix), GenerateOptions{})
+	return append(slices.Clip(prefix), m.Vocab.Symbols(out)...)
+}
+
 func (m *Markov) Generate() string {
-	w := m.Start[m.RNG(len(m.Start))]
-	out := []string{w}
+	s, _ := m.GenerateWith(GenerateOptions{})
+	return s
+}
+
+// GenerateFrom continues a sentence beginning with prefix. If the last
+// Order words of the prefix were never seen together, generation resumes
+// from a known prefix sharing the longest possible ending with it.
+func (m *Markov) GenerateFrom(prefix []string) string {
+	s, _ := m.GenerateWith(GenerateOptions{Prompt: prefix})
+	return s
+}
+
+// maxWalk bounds the tokens sampled by walk without opts.MaxTokens, so that
+// walks that can hardly leave a loop, such as cold sampling, end.
+const maxWalk = 10000
+
+// walk samples tokens from key until the end of a sequence. It gives up
+// when the sequence would get longer than opts.MaxTokens or maxWalk, or
+// when it gets back to a visited key and may loop forever, either because
+// every token since the last visit was the only one possible or because
+// opts.NoCycles is set.
+func (m *Model[T]) walk(key NGram, opts GenerateOptions) (out []Token, err error) {
+	visited := map[NGram]int{}
+	track := opts.NoCycles || opts.shaped()
+	chosen := -1 // position of the last token sampled among several
 	for {
-		candidates := m.Chain[w]
-		if len(candidates) == 0 {
-			break
+		if track {
+			if i, ok := visited[key]; ok && (opts.NoCycles || i > chosen) {
+				return out, ErrCycle
+			}
+			visited[key] = len(out)
+		}
+		next, forced := m.choice(key, opts)
+		if !forced {
+			chosen = len(out)
+		}
+		if next == EOS {
+			return out, nil
+		}
+		if opts.MaxTokens > 0 && len(opts.Prompt)+len(out) >= opts.MaxTokens || len(out) >= maxWalk {
+			return out, ErrTooLong
 		}
-		next := candidates[m.RNG(len(candidates))]
 		out = append(out, next)
-		parts := strings.Fields(w)
-		if len(parts) < m.Order {
-			break
+		copy(key[:], key[1:m.Order])
+		key[m.Order-1] = next
+	}
+}
+
+// next samples the token following key, or returns EOS if nothing does.
+func (m *Model[T]) next(key NGram) Token {
+	switch m.Backoff {
+	case StupidBackoff:
+		return m.nextStupid(key)
+	case Interpolated:
+		return m.nextInterpolated(key)
+	}
+	if t := m.follow(key, m.Order); t != nil {
+		return t.pick(m.RNG(t.Total))
+	}
+	return EOS
+}
+
+// levels returns the transitions after key and its suffixes, longest first,
+// with nil for unseen prefixes.
+func (m *Model[T]) levels(key NGram) []*Transitions {
+	ts := make([]*Transitions, m.Order+1)
+	for n := m.Order; n >= 0; n-- {
+		ts[m.Order-n] = m.follow(key, n)
+	}
+	return ts
+}
+
+// nextStupid samples from S(w) = f(w|prefix) if w was seen after the prefix,
+// or Alpha*S(w|shorter prefix) otherwise. The words seen after a longer
+// prefix are always a subset of the words seen after its suffix, so each
+// level only has to exclude the words of the closest longer level.
+func (m *Model[T]) nextStupid(key NGram) Token {
+	ts := m.levels(key)
+	mass := make([]float64, len(ts))
+	excluded := make([]int, len(ts))
+	var prev *Transitions
+	discount := 1.0
+	for i, t := range ts {
+		if t != nil {
+			if prev != nil {
+				for _, w := range prev.Next {
+					if j := t.find(w); j >= 0 {
+						excluded[i] += t.Count[j]
+					}
+				}
+			}
+			mass[i] = discount * float64(t.Total-excluded[i]) / float64(t.Total)
+			prev = t
+		}
+		discount *= m.Alpha
+	}
+	i := choose(m.RNG, mass)
+	if i < 0 {
+		return EOS
+	}
+	t, r := ts[i], m.RNG(ts[i].Total-excluded[i])
+	prev = nil
+	for j := i - 1; j >= 0 && prev == nil; j-- {
+		prev = ts[j]
+	}
+	for j, w := range t.Next {
+		if prev != nil && prev.find(w) >= 0 {
+			continue
+		}
+		if r -= t.Count[j]; r < 0 {
+			return w
+		}
+	}
+	return EOS
+}
+
+// nextInterpolated samples from the mixture of all seen prefix lengths,
+// weighted by Lambda.
+func (m *Model[T]) nextInterpolated(key NGram) Token {
+	ts := m.levels(key)
+	weights := make([]float64, len(ts))
+	for i, t := range ts {
+		if t != nil {
+			weights[i] = m.lambda(m.Order - i)
 		}
-		w = strings.Join(append(parts[1:m.Order], next), " ")
 	}
-	return strings.TrimSpace(strings.Join(out, " "))
+	if i := choose(m.RNG, weights); i >= 0 {
+		return ts[i].pick(m.RNG(ts[i].Total))
+	}
+	return EOS
 }
 
-func main() {
-	markov := NewMarkov(2)
-	scanner := bufio.NewScanner(os.Stdin)
-	for scanner.Scan() {
-		words := strings.Fields(scanner.Text())
-		markov.Add(words)
+func (m *Model[T]) lambda(n int) float64 {
+	if n < len(m.Lambda) {
+		return m.Lambda[n]
+	}
+	return 1
+}
+
+// choose returns a random index with probability proportional to weights,
+// or -1 if all weights are zero.
+func choose(rng func(int) int, weights []float64) int {
+	sum := 0.0
+	for _, w := range weights {
+		sum += w
+	}
+	if sum <= 0 {
+		return -1
+	}
+	r := float64(rng(1<<30)) / (1 << 30) * sum
+	last := -1
+	for i, w := range weights {
+		if w > 0 {
+			if r -= w; r < 0 {
+				return i
+			}
+			last = i
+		}
+	}
+	return last
+}
+
+// tail returns the full-length key made of the last Order words of prefix.
+func (m *Model[T]) tail(prefix []T) NGram {
+	key := m.start()
+	for _, w := range prefix {
+		copy(key[:], key[1:m.Order])
+		key[m.Order-1] = m.Vocab.IDs[w] // unknown words become None
+	}
+	return key
+}
+
+// context returns the key to continue prefix from, falling back to shorter
+// endings of the prefix and finally to the beginning of a sequence.
+func (m *Model[T]) context(prefix []T) NGram {
+	tail := m.tail(prefix)
+	if m.Backoff != NoBackoff || m.follow(tail, m.Order) != nil {
+		return tail
+	}
+	for n := m.Order - 1; n > 0; n-- {
+		if key, ok := m.ending(tail, n); ok {
+			return key
+		}
+	}
+	return m.start()
+}
+
+// ending samples a key sharing its last n tokens with tail, weighted by how
+// often the keys were followed by anything.
+func (m *Model[T]) ending(tail NGram, n int) (NGram, bool) {
+	var keys []NGram
+	total := 0
+	for key, t := range m.Chain {
+		if slices.Equal(key[m.Order-n:m.Order], tail[m.Order-n:m.Order]) {
+			keys = append(keys, key)
+			total += t.Total
+		}
+	}
+	if total == 0 {
+		return tail, false
+	}
+	slices.SortFunc(keys, func(a, b NGram) int { return slices.Compare(a[:], b[:]) })
+	r := m.RNG(total)
+	for _, key := range keys {
+		if r -= m.Chain[key].Total; r < 0 {
+			return key, true
+		}
+	}
+	return tail, false
+}
+
+// Save writes the model as a version header line followed by gob-encoded
+// settings, vocabulary and chains.
+func (m *Markov) Save(w io.Writer) error {
+	if _, err := fmt.Fprintf(w, "markov %d\n", FormatVersion); err != nil {
+		return err
+	}
+	return gob.NewEncoder(w).Encode(model{m.Order, m.Mode, m.Backoff, m.Alpha, m.Lambda, m.Vocab.Words, m.Chain, m.Backward, m.Index})
+}
+
+// Load replaces the model with the one read from r, keeping the RNG. It
+// returns ErrFormat, leaving the model unchanged, if the settings read are
+// out of range.
+func (m *Markov) Load(r io.Reader) error {
+	br := bufio.NewReader(r)
+	var version int
+	if _, err := fmt.Fscanf(br, "markov %d\n", &version); err != nil || version != FormatVersion {
+		return ErrFormat
+	}
+	var saved model
+	if err := gob.NewDecoder(br).Decode(&saved); err != nil {
+		return err
+	}
+	if saved.Order < 1 || saved.Order > MaxOrder || saved.Mode < Words || saved.Mode > Sentences ||
+		saved.Backoff < NoBackoff || saved.Backoff > Interpolated || len(saved.Words) <= int(EOS) {
+		return ErrFormat
+	}
+	m.Order, m.Mode, m.Backoff, m.Alpha, m.Lambda = saved.Order, saved.Mode, saved.Backoff, saved.Alpha, saved.Lambda
+	m.Vocab, m.Chain, m.Backward, m.Index, m.kn = newWords(saved.Words[EOS+1:]...), saved.Chain, saved.Backward, saved.Index, nil
+	m.edges, m.added = m.transitions(), 0
+	if m.Index != nil {
+		for i := range m.Index.Seqs {
+			m.Index.index(i)
+		}
 	}
-	fmt.Println(markov.Generate())
+	return nil
 }
@@ -1,7 +1,12 @@
 package main
 
 import (
+	"bytes"
+	"math"
 	"math/rand"
+	"os"
+	"reflect"
+	"slices"
 	"strings"
 	"testing"
 )
@@ -9,29 +14,266 @@ import (
 func TestMarkov(t *testing.T) {
 	m := NewMarkov(2)
 	m.Add(strings.Split("Mary had a little lamb little lamb little lamb", " "))
-	if len(m.Start) != 1 {
-		t.Error(m.Start)
+	if tr := successors(m, "<s> <s>"); !reflect.DeepEqual(m.Vocab.Symbols(tr.Next), []string{"Mary"}) {
+		t.Error(tr)
 	}
-	if len(m.Chain) != 6 {
+	if len(m.Chain) != 7 {
 		t.Error(len(m.Chain))
 	}
-	for _, prefix := range []string{"Mary had", "had a", "a little", "little lamb", "lamb little", "lamb "} {
-		if _, ok := m.Chain[prefix]; !ok {
+	for _, prefix := range []string{"<s> Mary", "Mary had", "had a", "a little", "little lamb", "lamb little"} {
+		if m.Chain[prefixKey(m, prefix)] == nil {
 			t.Error(prefix, m.Chain)
 		}
 	}
 	m.Add(strings.Split("Old McDonald had a farm", " "))
-	if len(m.Chain) != 10 {
+	if len(m.Chain) != 11 {
 		t.Error(len(m.Chain))
 	}
-	if len(m.Chain["had a"]) != 2 {
-		t.Error(m.Chain["had a"])
+	if tr := successors(m, "had a"); !reflect.DeepEqual(m.Vocab.Symbols(tr.Next), []string{"little", "farm"}) || tr.Total != 2 {
+		t.Error(tr)
+	}
+	if tr := successors(m, "little lamb"); !reflect.DeepEqual(tr.Next, []Token{m.Vocab.IDs["little"], EOS}) || !reflect.DeepEqual(tr.Count, []int{2, 1}) {
+		t.Error(tr)
 	}
 	rand.Seed(12)
-	if s := m.Generate(); s != "Old McDonald had a little lamb little lamb" {
+	if s := m.Generate(); s != "Old McDonald had a little lamb little lamb little lamb little lamb" {
 		t.Error(s)
 	}
 	if s := m.Generate(); s != "Mary had a farm" {
 		t.Error(s)
 	}
 }
+
+func TestGenerateFrom(t *testing.T) {
+	m := NewMarkov(2)
+	m.Add(strings.Fields("Mary had a little lamb"))
+	m.Add(strings.Fields("Old McDonald had a farm"))
+	m.RNG = rand.New(rand.NewSource(1)).Intn
+	for _, test := range []struct {
+		Prefix string
+		Result []string
+	}{
+		{"Old McDonald", []string{"Old McDonald had a little lamb", "Old McDonald had a farm"}},
+		{"I had a", []string{"I had a little lamb", "I had a farm"}},
+		{"my little", []string{"my little lamb"}},
+		{"my farm", []string{"my farm"}},
+		{"Hello", []string{"Hello Mary had a little lamb", "Hello Mary had a farm", "Hello Old McDonald had a little lamb", "Hello Old McDonald had a farm"}},
+	} {
+		for i := 0; i < 10; i++ {
+			if s := m.GenerateFrom(strings.Fields(test.Prefix)); !slices.Contains(test.Result, s) {
+				t.Error(test.Prefix, s)
+			}
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	for _, test := range []struct {
+		Backoff Backoff
+		Probs   map[string]float64
+	}{
+		{StupidBackoff, map[string]float64{"a": 0.0727, "b": 0.409, "c": 0.409, "</s>": 0.109}},
+		{Interpolated, map[string]float64{"a": 0.111, "b": 0.361, "c": 0.361, "</s>": 0.167}},
+	} {
+		m := NewMarkov(1)
+		m.Backoff = test.Backoff
+		m.RNG = rand.New(rand.NewSource(1)).Intn
+		for _, s := range []string{"a b", "a c", "b c"} {
+			m.Add(strings.Fields(s))
+		}
+		if len(m.Chain) != 5 || successors(m, "").Total != 9 {
+			t.Error(len(m.Chain), successors(m, ""))
+		}
+		key, _ := m.lookup([]string{"a"})
+		counts := map[string]int{}
+		for i := 0; i < 20000; i++ {
+			counts[m.Vocab.Words[m.next(key)]]++
+		}
+		for w, p := range test.Probs {
+			if f := float64(counts[w]) / 20000; math.Abs(f-p) > 0.015 {
+				t.Error(test.Backoff, w, f, p)
+			}
+		}
+		// Unseen prefixes back off instead of ending the sentence
+		if s := m.GenerateFrom([]string{"x"}); s == "x" {
+			t.Error(s)
+		}
+	}
+}
+
+func TestChars(t *testing.T) {
+	m := NewMarkov(2)
+	m.Mode = Chars
+	if s := m.Split(" anna "); !reflect.DeepEqual(s, []string{"a", "n", "n", "a"}) {
+		t.Error(s)
+	}
+	m.Add(m.Split("ship"))
+	if len(m.Chain) != 5 {
+		t.Error(len(m.Chain))
+	}
+	if s := m.Generate(); s != "ship" {
+		t.Error(s)
+	}
+	m.Add(m.Split("shop"))
+	if tr := successors(m, "s h"); !reflect.DeepEqual(m.Vocab.Symbols(tr.Next), []string{"i", "o"}) {
+		t.Error(tr)
+	}
+}
+
+func TestModel(t *testing.T) {
+	// Zero is an ordinary symbol, not a reserved token
+	ids := NewModel[int](1)
+	ids.Add([]int{0, 1, 2})
+	ids.Add([]int{0, 1, 3})
+	for i := 0; i < 10; i++ {
+		if seq := ids.Generate(); !reflect.DeepEqual(seq, []int{0, 1, 2}) && !reflect.DeepEqual(seq, []int{0, 1, 3}) {
+			t.Fatal(seq)
+		}
+	}
+	if seq := ids.GenerateFrom([]int{1}); len(seq) != 2 || seq[0] != 1 {
+		t.Error(seq)
+	}
+	// Symbols may contain spaces
+	chords := NewModel[string](2)
+	song := []string{"C major", "A minor", "F major", "G major"}
+	chords.Add(song)
+	if seq := chords.Generate(); !reflect.DeepEqual(seq, song) {
+		t.Error(seq)
+	}
+	type event struct {
+		Kind string
+		Code int
+	}
+	events := NewModel[event](1)
+	events.Add([]event{{"open", 0}, {"read", 0}, {"close", 1}})
+	if seq := events.Generate(); len(seq) != 3 || seq[2] != (event{"close", 1}) {
+		t.Error(seq)
+	}
+	if lp := events.LogProb([]event{{"open", 0}, {"read", 0}, {"close", 1}}); lp >= 0 || math.IsInf(lp, 0) {
+		t.Error(lp)
+	}
+}
+
+func TestReservedWords(t *testing.T) {
+	m := NewMarkov(1)
+	m.Add(strings.Fields("a b </s> <s> c"))
+	if s := m.Generate(); s != "a b </s> <s> c" {
+		t.Error(s)
+	}
+}
+
+func successors(m *Markov, prefix string) *Transitions {
+	return m.Chain[prefixKey(m, prefix)]
+}
+
+// prefixKey returns the key of the words of prefix, where "<s>" is BOS.
+func prefixKey(m *Markov, prefix string) (key NGram) {
+	for i, w := range strings.Fields(prefix) {
+		key[i] = wordID(m, w)
+	}
+	return key
+}
+
+// wordID returns the token of a word, where "<s>" is BOS and "</s>" is EOS.
+func wordID(m *Markov, w string) Token {
+	switch w {
+	case "<s>":
+		return BOS
+	case "</s>":
+		return EOS
+	}
+	return m.Vocab.IDs[w]
+}
+
+func TestSaveLoad(t *testing.T) {
+	m := NewMarkov(2)
+	m.Add(strings.Fields("Mary had a little lamb little lamb little lamb"))
+	m.Add(strings.Fields("Old McDonald had a farm"))
+	var b bytes.Buffer
+	if err := m.Save(&b); err != nil {
+		t.Fatal(err)
+	}
+	loaded := NewMarkov(1)
+	if err := loaded.Load(&b); err != nil {
+		t.Fatal(err)
+	}
+	for _, tr := range m.Chain {
+		tr.index = nil
+	}
+	if loaded.Order != m.Order || loaded.Mode != m.Mode || loaded.Backoff != m.Backoff || !reflect.DeepEqual(loaded.Vocab, m.Vocab) || !reflect.DeepEqual(loaded.Chain, m.Chain) {
+		t.Error(loaded)
+	}
+	if err := loaded.Load(strings.NewReader("markov 999\n")); err != ErrFormat {
+		t.Error(err)
+	}
+	// Settings out of range fail to load instead of panicking later
+	for _, bad := range []func(*Markov){
+		func(m *Markov) { m.Order = 0 },
+		func(m *Markov) { m.Order = MaxOrder + 1 },
+		func(m *Markov) { m.Mode = Sentences + 1 },
+		func(m *Markov) { m.Backoff = -1 },
+	} {
+		m := NewMarkov(2)
+		m.Add(strings.Fields("Mary had a little lamb"))
+		bad(m)
+		b.Reset()
+		if err := m.Save(&b); err != nil {
+			t.Fatal(err)
+		}
+		if err := loaded.Load(&b); err != ErrFormat || loaded.Order != 2 {
+			t.Error(err, loaded.Order)
+		}
+	}
+}
+
+func homer(b *testing.B) (lines [][]string) {
+	data, err := os.ReadFile("homer.txt")
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		lines = append(lines, strings.Fields(line))
+	}
+	return lines
+}
+
+func BenchmarkTrain(b *testing.B) {
+	lines := homer(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m := NewMarkov(2)
+		for _, words := range lines {
+			m.Add(words)
+		}
+	}
+}
+
+func BenchmarkGenerate(b *testing.B) {
+	m := NewMarkov(2)
+	for _, words := range homer(b) {
+		m.Add(words)
+	}
+	m.RNG = rand.New(rand.NewSource(1)).Intn
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.Generate()
+	}
+}
+
+func BenchmarkTrainParallel(b *testing.B) {
+	lines := homer(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		seqs := make(chan []string, 1024)
+		go func() {
+			for _, words := range lines {
+				seqs <- words
+			}
+			close(seqs)
+		}()
+		Train(func() *Markov { return NewMarkov(2) }, seqs, 4)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"slices"
+)
+
+var (
+	ErrMismatch = errors.New("markov: models have different settings")
+	ErrWeight   = errors.New("markov: weight must be within 0..1")
+)
+
+// Mashup generates from several models at once. Every token comes from one
+// of the models that know the current prefix, chosen by weight.
+type Mashup struct {
+	Models  []*Markov
+	Weights []float64
+	RNG     func(int) int
+}
+
+// size returns the number of transitions the model was trained on.
+func (m *Model[T]) size() (n int) {
+	for key, t := range m.Chain {
+		if key[m.Order-1] != None {
+			n += t.Total
+		}
+	}
+	return n
+}
+
+// Merge returns a model combining a and b, where a contributes weight and b
+// contributes 1-weight of the transitions regardless of how much text each
+// was trained on. The merged model has about as many transitions as both
+// together, so it can be trained further. Both models must have the same
+// settings, including Alpha and Lambda.
+func Merge(a, b *Markov, weight float64) (*Markov, error) {
+	if !(weight >= 0 && weight <= 1) {
+		return nil, ErrWeight
+	}
+	if a.Order != b.Order || a.Mode != b.Mode || a.Backoff != b.Backoff || a.Alpha != b.Alpha || !slices.Equal(a.Lambda, b.Lambda) {
+		return nil, ErrMismatch
+	}
+	m := NewMarkov(a.Order)
+	m.Mode, m.Backoff, m.Alpha, m.Lambda, m.Smoothing = a.Mode, a.Backoff, a.Alpha, a.Lambda, a.Smoothing
+	if a.Index != nil || b.Index != nil {
+		m.Index = NewIndex()
+	}
+	if a.Backward != nil && b.Backward != nil {
+		m.Backward = map[NGram]*Transitions{}
+	}
+	na, nb := float64(a.size()), float64(b.size())
+	if weight > 0 && na > 0 {
+		m.merge(a.Model, weight*(na+nb)/na)
+	}
+	if weight < 1 && nb > 0 {
+		m.merge(b.Model, (1-weight)*(na+nb)/nb)
+	}
+	return m, nil
+}
+
+func NewMashup(models ...*Markov) *Mashup {
+	weights := make([]float64, len(models))
+	for i := range weights {
+		weights[i] = 1
+	}
+	return &Mashup{Models: models, Weights: weights, RNG: models[0].RNG}
+}
+
+// Generate returns a sequence and, for every token, the index of the model
+// that produced it. It ends when the chosen model ends the sequence or no
+// model knows the prefix.
+func (x *Mashup) Generate() (tokens []string, sources []int) {
+	weights := make([]float64, len(x.Models))
+	keys := make([]NGram, len(x.Models))
+	for {
+		for i, m := range x.Models {
+			keys[i] = m.tail(tokens[max(0, len(tokens)-m.Order):])
+			weights[i] = 0
+			if m.Backoff != NoBackoff || m.follow(keys[i], m.Order) != nil {
+				weights[i] = x.Weights[i]
+			}
+		}
+		i := choose(x.RNG, weights)
+		if i < 0 {
+			return tokens, sources
+		}
+		next := x.Models[i].next(keys[i])
+		if next == EOS {
+			return tokens, sources
+		}
+		tokens = append(tokens, x.Models[i].Vocab.Words[next])
+		sources = append(sources, i)
+	}
+}
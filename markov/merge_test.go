@@ -0,0 +1,76 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	a, b := NewMarkov(1), NewMarkov(1)
+	a.Add(strings.Fields("the cat sat"))
+	b.Add(strings.Fields("the dog ran"))
+	b.Add(strings.Fields("the dog sat"))
+	for _, test := range []struct {
+		Weight   float64
+		Cat, Dog int
+	}{
+		{0.5, 2, 2},
+		{0.75, 2, 1},
+		{1, 3, 0},
+	} {
+		m, err := Merge(a, b, test.Weight)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tr := successors(m, "the")
+		cat, dog := tr.find(m.Vocab.IDs["cat"]), tr.find(m.Vocab.IDs["dog"])
+		if (test.Cat > 0) != (cat >= 0) || (test.Dog > 0) != (dog >= 0) ||
+			(cat >= 0 && tr.Count[cat] != test.Cat) || (dog >= 0 && tr.Count[dog] != test.Dog) {
+			t.Error(test.Weight, m.Vocab.Symbols(tr.Next), tr.Count)
+		}
+	}
+	if _, err := Merge(a, NewMarkov(2), 0.5); err != ErrMismatch {
+		t.Error(err)
+	}
+	c := NewMarkov(1)
+	c.Alpha = 0.1
+	if _, err := Merge(a, c, 0.5); err != ErrMismatch {
+		t.Error(err)
+	}
+	for _, w := range []float64{-0.5, 2, math.NaN()} {
+		if _, err := Merge(a, b, w); err != ErrWeight {
+			t.Error(w, err)
+		}
+	}
+}
+
+func TestMashup(t *testing.T) {
+	a, b := NewMarkov(1), NewMarkov(1)
+	a.Add(strings.Fields("the cat sat"))
+	b.Add(strings.Fields("the dog ran"))
+	x := NewMashup(a, b)
+	x.RNG = rand.New(rand.NewSource(1)).Intn
+	seen := map[string]bool{}
+	for i := 0; i < 20; i++ {
+		tokens, sources := x.Generate()
+		if len(tokens) != 3 || len(sources) != 3 {
+			t.Fatal(tokens, sources)
+		}
+		for j, w := range tokens {
+			m := x.Models[sources[j]]
+			prev := "<s>"
+			if j > 0 {
+				prev = tokens[j-1]
+			}
+			if tr := successors(m, prev); tr == nil || tr.find(m.Vocab.IDs[w]) < 0 {
+				t.Fatal(tokens, sources)
+			}
+		}
+		seen[strings.Join(tokens, " ")] = true
+	}
+	if len(seen) != 2 {
+		t.Error(seen)
+	}
+}
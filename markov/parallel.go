@@ -0,0 +1,123 @@
+package main
+
+import (
+	"math"
+	"sync"
+)
+
+// Frozen is a read-only model, safe for concurrent use.
+type Frozen struct {
+	m Markov
+}
+
+// Train builds a model from seqs with several goroutines, at least one.
+// Each of them trains its own model created by newModel on a share of the
+// sequences, and the models are merged at the end. Counts are the same as
+// with sequential training, but successors may be stored in a different
+// order. Budget and HalfLife apply to every worker's model, so counts are
+// halved about every workers×HalfLife sequences, and the merged model is
+// pruned to Budget again.
+func Train(newModel func() *Markov, seqs <-chan []string, workers int) *Markov {
+	if workers < 1 {
+		panic("markov: workers must be at least 1")
+	}
+	models := make([]*Markov, workers)
+	var wg sync.WaitGroup
+	for i := range models {
+		models[i] = newModel()
+		wg.Add(1)
+		go func(m *Markov) {
+			defer wg.Done()
+			for seq := range seqs {
+				m.Add(seq)
+			}
+		}(models[i])
+	}
+	wg.Wait()
+	m := newModel()
+	for _, o := range models {
+		m.merge(o.Model, 1)
+		m.Evicted.add(o.Evicted)
+	}
+	if m.Budget > 0 {
+		m.Prune(m.Budget)
+	}
+	return m
+}
+
+// merge adds the counts of o multiplied by scale, its Backward chain and
+// its training sequences to m. Both models must have the same Order and
+// Backoff. Scaled counts are rounded, but seen transitions are kept with a
+// count of at least one.
+func (m *Model[T]) merge(o *Model[T], scale float64) {
+	m.kn = nil
+	remap := []Token{None, BOS, EOS}
+	for _, w := range o.Vocab.Words[EOS+1:] {
+		remap = append(remap, m.Vocab.ID(w))
+	}
+	m.edges += m.mergeChain(o.Chain, remap, scale)
+	if m.Backward != nil && o.Backward != nil {
+		m.edges += m.backward().mergeChain(o.Backward, remap, scale)
+	}
+	if m.Index != nil && o.Index != nil {
+		for _, seq := range o.Index.Seqs {
+			ids := make([]Token, len(seq))
+			for i, id := range seq {
+				ids[i] = remap[id]
+			}
+			m.Index.add(ids)
+		}
+	}
+}
+
+func (m *Model[T]) mergeChain(chain map[NGram]*Transitions, remap []Token, scale float64) (added int) {
+	for key, t := range chain {
+		for i := range key {
+			key[i] = remap[key[i]]
+		}
+		for i, next := range t.Next {
+			c := t.Count[i]
+			if scale != 1 {
+				c = max(1, int(math.Round(float64(c)*scale)))
+			}
+			if m.count(key, remap[next], c) {
+				added++
+			}
+		}
+	}
+	return added
+}
+
+// Freeze prepares the model for concurrent reads: lookup indices,
+// cumulative counts and smoothing statistics are built once. The model
+// must not be trained after it is frozen.
+func (m *Markov) Freeze() *Frozen {
+	for _, chain := range []map[NGram]*Transitions{m.Chain, m.Backward} {
+		for _, t := range chain {
+			t.find(None) // builds the index of long successor lists
+			t.cum = make([]int, len(t.Count))
+			sum := 0
+			for i, c := range t.Count {
+				sum += c
+				t.cum[i] = sum
+			}
+		}
+	}
+	if _, ok := m.Smoothing.(KneserNey); ok {
+		m.kneserNey()
+	}
+	return &Frozen{*m}
+}
+
+// Generate samples a sequence like Markov.GenerateWith, using rng instead
+// of the model's RNG.
+func (f *Frozen) Generate(rng func(int) int, opts GenerateOptions) (string, error) {
+	model := *f.m.Model
+	model.RNG = rng
+	m := Markov{&model, f.m.Mode}
+	return m.GenerateWith(opts)
+}
+
+func (f *Frozen) LogProb(words []string) float64 {
+	return f.m.LogProb(words)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"math/rand"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestTrain(t *testing.T) {
+	lines := []string{"Mary had a little lamb little lamb little lamb", "Old McDonald had a farm", "a little farm", "Mary had a farm"}
+	for _, backoff := range []Backoff{NoBackoff, Interpolated} {
+		newModel := func() *Markov {
+			m := NewMarkov(2)
+			m.Backoff, m.Index = backoff, NewIndex()
+			return m
+		}
+		seq := newModel()
+		seqs := make(chan []string, len(lines))
+		for _, line := range lines {
+			seq.Add(strings.Fields(line))
+			seqs <- strings.Fields(line)
+		}
+		close(seqs)
+		par := Train(newModel, seqs, 3)
+		if len(par.Chain) != len(seq.Chain) || len(par.Index.Seqs) != len(lines) {
+			t.Fatal(len(par.Chain), len(seq.Chain))
+		}
+		for key, st := range seq.Chain {
+			words := seq.Vocab.Symbols(key[:seq.Order])
+			pt := par.Chain[prefixKey(par, strings.Join(words, " "))]
+			if pt == nil || pt.Total != st.Total || len(pt.Next) != len(st.Next) {
+				t.Fatal(words, pt, st)
+			}
+			for i, next := range st.Next {
+				if j := pt.find(wordID(par, seq.Vocab.Words[next])); j < 0 || pt.Count[j] != st.Count[i] {
+					t.Fatal(words, seq.Vocab.Words[next])
+				}
+			}
+		}
+	}
+}
+
+func TestFrozen(t *testing.T) {
+	b, err := os.ReadFile("homer.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := NewMarkov(2)
+	m.Backoff = StupidBackoff
+	for _, line := range strings.Split(string(b), "\n")[:2000] {
+		m.Add(strings.Fields(line))
+	}
+	f := m.Freeze()
+	results := make([]string, 8)
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(int64(i % 2))).Intn
+			for j := 0; j < 50; j++ {
+				results[i], _ = f.Generate(rng, GenerateOptions{MaxTokens: 30})
+				f.LogProb(strings.Fields(results[i]))
+			}
+		}(i)
+	}
+	wg.Wait()
+	// Generators with the same seed must not disturb each other
+	for i := 2; i < len(results); i++ {
+		if results[i] != results[i%2] {
+			t.Error(i, results[i], results[i%2])
+		}
+	}
+}
+
+func TestTrainWorkers(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("training without workers did not panic")
+		}
+	}()
+	Train(func() *Markov { return NewMarkov(1) }, make(chan []string), 0)
+}
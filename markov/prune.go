@@ -0,0 +1,120 @@
+package main
+
+import (
+	"math"
+	"sort"
+)
+
+// Evictions counts what was removed from a model to bound its size or to
+// forget old sequences.
+type Evictions struct {
+	Prunes      int // calls to Prune that removed anything
+	Decays      int // calls to Decay
+	Transitions int // transitions removed
+	States      int // prefixes left without transitions and removed
+	Count       int // occurrences removed, including those decayed away
+}
+
+func (e *Evictions) add(o Evictions) {
+	e.Prunes += o.Prunes
+	e.Decays += o.Decays
+	e.Transitions += o.Transitions
+	e.States += o.States
+	e.Count += o.Count
+}
+
+// transitions returns the number of transitions in Chain and Backward,
+// except those to EOS, which Prune never removes.
+func (m *Model[T]) transitions() (n int) {
+	for _, chain := range []map[NGram]*Transitions{m.Chain, m.Backward} {
+		for _, t := range chain {
+			for _, next := range t.Next {
+				if next != EOS {
+					n++
+				}
+			}
+		}
+	}
+	return n
+}
+
+// Prune removes the rarest transitions so that at most n remain, and the
+// prefixes left without any. All transitions seen equally often are kept
+// or removed together, so fewer than n may remain. Transitions to EOS are
+// never removed, so that generation can still leave every loop, and they
+// are not counted in n: a model keeps one for every distinct ending of
+// its sequences, however many there are. Since a prefix is never seen
+// more often than its suffixes, shorter prefixes trained for Backoff keep
+// the successors of longer ones.
+func (m *Model[T]) Prune(n int) {
+	if m.edges <= n {
+		return
+	}
+	hist := map[int]int{}
+	for _, chain := range []map[NGram]*Transitions{m.Chain, m.Backward} {
+		for _, t := range chain {
+			for i, c := range t.Count {
+				if t.Next[i] != EOS {
+					hist[c]++
+				}
+			}
+		}
+	}
+	counts := make([]int, 0, len(hist))
+	for c := range hist {
+		counts = append(counts, c)
+	}
+	sort.Ints(counts)
+	threshold, left := 0, m.edges
+	for _, c := range counts {
+		if left <= n {
+			break
+		}
+		threshold, left = c, left-hist[c]
+	}
+	m.Evicted.Prunes++
+	m.filter(func(c int) int {
+		if c <= threshold {
+			return 0
+		}
+		return c
+	})
+}
+
+// Decay multiplies all counts by f, 0 < f < 1, rounding down, so older
+// sequences weigh less than newer ones. Transitions whose count drops to
+// zero are removed, except those to EOS, which keep a count of one.
+func (m *Model[T]) Decay(f float64) {
+	m.added = 0
+	m.Evicted.Decays++
+	m.filter(func(c int) int { return int(math.Floor(float64(c) * f)) })
+}
+
+// filter replaces every count c by scale(c), removing zero counts and the
+// prefixes left without transitions. Transitions to EOS are kept.
+func (m *Model[T]) filter(scale func(c int) int) {
+	m.kn = nil
+	for _, chain := range []map[NGram]*Transitions{m.Chain, m.Backward} {
+		for key, t := range chain {
+			next, count, total := t.Next[:0], t.Count[:0], 0
+			for i, w := range t.Next {
+				c := scale(t.Count[i])
+				if w == EOS {
+					c = max(1, c)
+				}
+				m.Evicted.Count += t.Count[i] - c
+				if c <= 0 {
+					m.Evicted.Transitions++
+					m.edges--
+					continue
+				}
+				next, count, total = append(next, w), append(count, c), total+c
+			}
+			t.Next, t.Count, t.Total, t.index, t.cum = next, count, total, nil, nil
+			if total == 0 {
+				delete(chain, key)
+				m.Evicted.States++
+			}
+		}
+	}
+}
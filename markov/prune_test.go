@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPrune(t *testing.T) {
+	m := NewMarkov(1)
+	for _, s := range []string{"a b", "a b", "a c"} {
+		m.Add(strings.Fields(s))
+	}
+	m.Prune(2)
+	if n := m.transitions(); n != 2 || n != m.edges {
+		t.Error(n, m.edges)
+	}
+	if !reflect.DeepEqual(m.Evicted, Evictions{Prunes: 1, Transitions: 1, Count: 1}) {
+		t.Error(m.Evicted)
+	}
+	if tr := successors(m, "a"); !reflect.DeepEqual(m.Vocab.Symbols(tr.Next), []string{"b"}) || tr.Total != 2 {
+		t.Error(tr)
+	}
+	// The end of a sequence is kept
+	if tr := successors(m, "c"); tr == nil || !reflect.DeepEqual(tr.Next, []Token{EOS}) {
+		t.Error(tr)
+	}
+	m.Decay(0.5)
+	for key, tr := range m.Chain {
+		if tr.Total != 1 || !reflect.DeepEqual(tr.Count, []int{1}) {
+			t.Error(m.Vocab.Symbols(key[:1]), tr)
+		}
+	}
+	if m.Evicted.Decays != 1 || m.Evicted.Count != 5 || m.Evicted.Transitions != 1 {
+		t.Error(m.Evicted)
+	}
+}
+
+func TestPruneLoop(t *testing.T) {
+	m := NewMarkov(2)
+	m.Add(strings.Fields("a b x y x y"))
+	m.Add(strings.Fields("a b x y x y x"))
+	m.Prune(m.edges - 1)
+	// Both ends of the x y loop are rare, but they are its only exits
+	for i := 0; i < 10; i++ {
+		if s, err := m.GenerateWith(GenerateOptions{Prompt: []string{"x", "y"}}); err != nil {
+			t.Fatal(s, err)
+		}
+	}
+}
+
+func TestBudget(t *testing.T) {
+	lines := []string{
+		"Mary had a little lamb little lamb little lamb",
+		"Old McDonald had a farm",
+		"Mary had a farm",
+		"a little farm",
+		"Old McDonald had a little lamb",
+	}
+	m := NewMarkov(2)
+	m.Backoff, m.Budget = StupidBackoff, 20
+	for i := 0; i < 5; i++ {
+		for _, line := range lines {
+			m.Add(strings.Fields(line))
+			if n := m.transitions(); n > m.Budget || n != m.edges {
+				t.Fatal(n, m.edges)
+			}
+		}
+	}
+	if m.Evicted.Prunes == 0 || m.Evicted.Transitions == 0 {
+		t.Error(m.Evicted)
+	}
+	// Successors of a prefix are kept for its suffixes, as backoff expects
+	for key, tr := range m.Chain {
+		if key[m.Order-1] == None {
+			continue
+		}
+		short := m.Chain[m.suffix(key, m.Order-1)]
+		for _, w := range tr.Next {
+			if short == nil || short.find(w) < 0 {
+				t.Error(m.Vocab.Symbols(key[:m.Order]), m.Vocab.Words[w])
+			}
+		}
+	}
+	if s := m.Generate(); s == "" {
+		t.Error(s)
+	}
+}
+
+func TestBudgetEndings(t *testing.T) {
+	m := NewMarkov(1)
+	m.Budget = 10
+	for i := 0; i < 20; i++ {
+		m.Add([]string{"the", "end", fmt.Sprint(i)})
+	}
+	// Distinct endings are kept beyond the budget, the rest is not evicted
+	if n := m.transitions(); n > m.Budget || n != m.edges {
+		t.Error(n, m.edges)
+	}
+	if m.Chain[m.start()] == nil {
+		t.Error(m.Evicted)
+	}
+	if s := m.Generate(); !strings.HasPrefix(s, "the end") {
+		t.Error(s)
+	}
+}
+
+func TestHalfLife(t *testing.T) {
+	m := NewMarkov(1)
+	m.HalfLife = 4
+	for i := 0; i < 4; i++ {
+		m.Add([]string{"old"})
+	}
+	for i := 0; i < 3; i++ {
+		m.Add([]string{"new"})
+	}
+	if m.Evicted.Decays != 1 {
+		t.Error(m.Evicted)
+	}
+	// The old word had 4 occurrences halved to 2, the new one has 3
+	if tr := successors(m, "<s>"); !reflect.DeepEqual(m.Vocab.Symbols(tr.Next), []string{"old", "new"}) || !reflect.DeepEqual(tr.Count, []int{2, 3}) {
+		t.Error(tr)
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"math"
+	"slices"
+	"sort"
+)
+
+// GenerateOptions tune sampling. The zero value samples from the model as
+// is, starting a new sequence.
+type GenerateOptions struct {
+	Prompt      []string // beginning of the sequence to continue, see GenerateFrom
+	Anchor      []string // words the sequence must contain, needs a Backward chain, overrides Prompt
+	Temperature float64  // below 1 sharpens, above 1 flattens the distribution, 0 means 1
+	TopK        int      // sample from the K most likely tokens only, 0 means all
+	TopP        float64  // sample from the most likely tokens covering P of the mass, 0 means all
+	Greedy      bool     // always take the most likely token
+	MaxCopy     int      // reject sequences copying more tokens in a row from the Index, needs one, 0 allows any
+	MinTokens   int      // reject shorter sequences, including the prompt
+	MaxTokens   int      // reject longer sequences, including the prompt, 0 allows any
+	End         bool     // reject sequences not ending with terminal punctuation
+	NoCycles    bool     // reject sequences going through the same prefix twice
+	Retries     int      // number of times a rejected sequence is resampled
+}
+
+func (opts GenerateOptions) shaped() bool {
+	return opts.Greedy || opts.TopK > 0 || (opts.TopP > 0 && opts.TopP < 1) ||
+		(opts.Temperature > 0 && opts.Temperature != 1)
+}
+
+// GenerateWith samples a sequence according to opts. If every attempt is
+// rejected, the last one is returned along with the reason. MaxCopy needs
+// an Index, without one ErrNoIndex is returned.
+func (m *Markov) GenerateWith(opts GenerateOptions) (string, error) {
+	if opts.MaxCopy > 0 && m.Index == nil {
+		return "", ErrNoIndex
+	}
+	var words []string
+	var err error
+	for attempt := 0; attempt <= opts.Retries; attempt++ {
+		var out []Token
+		if len(opts.Anchor) > 0 {
+			out, err = m.anchored(opts.Anchor, opts)
+			words = m.Vocab.Symbols(out)
+		} else {
+			out, err = m.walk(m.context(opts.Prompt), opts)
+			words = append(slices.Clip(opts.Prompt), m.Vocab.Symbols(out)...)
+		}
+		if err == nil {
+			err = m.check(words, opts)
+		}
+		if err == nil {
+			break
+		}
+	}
+	return m.Join(words), err
+}
+
+// check returns why a generated sequence does not satisfy opts, if it doesn't.
+func (m *Markov) check(words []string, opts GenerateOptions) error {
+	if len(words) < opts.MinTokens {
+		return ErrTooShort
+	}
+	if opts.MaxTokens > 0 && len(words) > opts.MaxTokens {
+		return ErrTooLong
+	}
+	if opts.End && (len(words) == 0 || !endsSentence(words[len(words)-1])) {
+		return ErrNoEnd
+	}
+	if opts.MaxCopy > 0 {
+		if span := m.Copied(words); len(span) > opts.MaxCopy {
+			return &CopyError{span}
+		}
+	}
+	return nil
+}
+
+// sample returns the token following key, reshaping the distribution as
+// requested by opts.
+func (m *Model[T]) sample(key NGram, opts GenerateOptions) Token {
+	next, _ := m.choice(key, opts)
+	return next
+}
+
+// choice is sample that also reports if the reshaped distribution left
+// no other token possible.
+func (m *Model[T]) choice(key NGram, opts GenerateOptions) (Token, bool) {
+	if !opts.shaped() {
+		return m.next(key), false
+	}
+	tokens, probs := m.dist(key)
+	if len(tokens) == 0 {
+		return EOS, true
+	}
+	order := make([]int, len(tokens))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return probs[order[i]] > probs[order[j]] })
+	if opts.Greedy {
+		return tokens[order[0]], true
+	}
+	if t := opts.Temperature; t > 0 && t != 1 {
+		max := math.Log(probs[order[0]])
+		for i, p := range probs {
+			probs[i] = math.Exp((math.Log(p) - max) / t)
+		}
+	}
+	keep := len(order)
+	if opts.TopK > 0 && opts.TopK < keep {
+		keep = opts.TopK
+	}
+	if opts.TopP > 0 && opts.TopP < 1 {
+		sum, cum := 0.0, 0.0
+		for _, i := range order {
+			sum += probs[i]
+		}
+		for n, i := range order[:keep] {
+			if cum += probs[i]; cum >= opts.TopP*sum {
+				keep = n + 1
+				break
+			}
+		}
+	}
+	weights := make([]float64, len(tokens))
+	possible := 0
+	for _, i := range order[:keep] {
+		if weights[i] = probs[i]; weights[i] > 0 {
+			possible++
+		}
+	}
+	if i := choose(m.RNG, weights); i >= 0 {
+		return tokens[i], possible == 1
+	}
+	return EOS, true
+}
+
+// dist returns the tokens that may follow key, in order of first
+// appearance, and their probabilities under the model's Backoff.
+func (m *Model[T]) dist(key NGram) (tokens []Token, probs []float64) {
+	ts := m.levels(key)
+	if m.Backoff == NoBackoff {
+		ts = ts[:1]
+	}
+	index := map[Token]int{}
+	discount, sum := 1.0, 0.0
+	for i, t := range ts {
+		if t == nil {
+			discount *= m.Alpha
+			continue
+		}
+		weight := 1.0
+		switch m.Backoff {
+		case StupidBackoff:
+			weight = discount
+		case Interpolated:
+			weight = m.lambda(m.Order - i)
+		}
+		for j, w := range t.Next {
+			p := weight * float64(t.Count[j]) / float64(t.Total)
+			k, ok := index[w]
+			if !ok {
+				index[w] = len(tokens)
+				tokens, probs = append(tokens, w), append(probs, p)
+				sum += p
+			} else if m.Backoff == Interpolated {
+				probs[k] += p
+				sum += p
+			}
+		}
+		discount *= m.Alpha
+	}
+	for i := range probs {
+		probs[i] /= sum
+	}
+	return tokens, probs
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestDist(t *testing.T) {
+	for _, test := range []struct {
+		Backoff Backoff
+		Probs   map[string]float64
+	}{
+		{NoBackoff, map[string]float64{"b": 0.5, "c": 0.5}},
+		{StupidBackoff, map[string]float64{"a": 0.4 * 2 / 9 / 1.2222222, "b": 0.5 / 1.2222222, "c": 0.5 / 1.2222222, "</s>": 0.4 * 3 / 9 / 1.2222222}},
+		{Interpolated, map[string]float64{"a": 1.0 / 9, "b": 0.25 + 1.0/9, "c": 0.25 + 1.0/9, "</s>": 1.0 / 6}},
+	} {
+		m := NewMarkov(1)
+		m.Backoff = test.Backoff
+		for _, s := range []string{"a b", "a c", "b c"} {
+			m.Add(strings.Fields(s))
+		}
+		key, _ := m.lookup([]string{"a"})
+		tokens, probs := m.dist(key)
+		if len(tokens) != len(test.Probs) {
+			t.Error(test.Backoff, m.Vocab.Symbols(tokens))
+		}
+		for i, w := range tokens {
+			if math.Abs(probs[i]-test.Probs[m.Vocab.Words[w]]) > 1e-6 {
+				t.Error(test.Backoff, m.Vocab.Words[w], probs[i])
+			}
+		}
+	}
+}
+
+func TestGenerateOptions(t *testing.T) {
+	m := NewMarkov(2)
+	m.Add(strings.Fields("Mary had a little lamb little lamb little lamb"))
+	m.Add(strings.Fields("Old McDonald had a farm"))
+	m.RNG = rand.New(rand.NewSource(1)).Intn
+	if s, _ := m.GenerateWith(GenerateOptions{Greedy: true}); s != "Mary had a little lamb little lamb" {
+		t.Error(s)
+	}
+	if s, _ := m.GenerateWith(GenerateOptions{Greedy: true, Prompt: []string{"Old"}}); s != "Old McDonald had a little lamb little lamb" {
+		t.Error(s)
+	}
+	if s, _ := m.GenerateWith(GenerateOptions{TopK: 1}); s != "Mary had a little lamb little lamb" {
+		t.Error(s)
+	}
+	for _, test := range []struct {
+		Prefix string
+		Opts   GenerateOptions
+		Next   string
+	}{
+		{"little lamb", GenerateOptions{Temperature: 0.01}, "little"},
+		{"had a", GenerateOptions{TopP: 0.5}, "little"},
+		{"<s> <s>", GenerateOptions{TopK: 1, Temperature: 100}, "Mary"},
+	} {
+		key := prefixKey(m, test.Prefix)
+		for i := 0; i < 100; i++ {
+			if next := m.Vocab.Words[m.sample(key, test.Opts)]; next != test.Next {
+				t.Fatal(test.Prefix, next)
+			}
+		}
+	}
+	counts := map[string]int{}
+	key, _ := m.lookup(strings.Fields("little lamb"))
+	for i := 0; i < 1000; i++ {
+		counts[m.Vocab.Words[m.sample(key, GenerateOptions{Temperature: 1000})]]++
+	}
+	if counts["little"] < 400 || counts["</s>"] < 400 {
+		t.Error(counts)
+	}
+}
+
+func TestConstraints(t *testing.T) {
+	m := NewMarkov(2)
+	m.Add(strings.Fields("Mary had a little lamb little lamb little lamb"))
+	m.Add(strings.Fields("Old McDonald had a farm."))
+	m.Add(strings.Fields("Hi!"))
+	m.RNG = rand.New(rand.NewSource(1)).Intn
+	for _, test := range []struct {
+		Opts GenerateOptions
+		Err  error
+		OK   func(words []string) bool
+	}{
+		{GenerateOptions{MinTokens: 4, Retries: 100}, nil, func(w []string) bool { return len(w) >= 4 }},
+		{GenerateOptions{MaxTokens: 4, Retries: 100}, nil, func(w []string) bool { return len(w) <= 4 }},
+		{GenerateOptions{End: true, Retries: 100}, nil, func(w []string) bool { return endsSentence(w[len(w)-1]) }},
+		{GenerateOptions{NoCycles: true, Retries: 100}, nil, func(w []string) bool { return strings.Count(strings.Join(w, " "), "little lamb") < 2 }},
+		{GenerateOptions{MinTokens: 100, Retries: 3}, ErrTooShort, nil},
+		{GenerateOptions{Prompt: []string{"a", "little"}, MaxTokens: 3, Retries: 100}, nil, func(w []string) bool { return len(w) == 3 }},
+		{GenerateOptions{Prompt: []string{"a", "little"}, MaxTokens: 2, Retries: 3}, ErrTooLong, nil},
+		{GenerateOptions{Prompt: []string{"a", "little"}, End: true, Retries: 3}, ErrNoEnd, nil},
+		{GenerateOptions{Prompt: []string{"a", "little"}, Greedy: true}, ErrCycle, nil},
+		{GenerateOptions{Prompt: []string{"a", "little"}, TopP: 0.5}, ErrCycle, nil},
+		{GenerateOptions{Prompt: []string{"a", "little"}, Temperature: 0.01}, ErrTooLong, nil},
+	} {
+		for i := 0; i < 20; i++ {
+			s, err := m.GenerateWith(test.Opts)
+			if err != test.Err || (test.OK != nil && !test.OK(strings.Fields(s))) {
+				t.Fatal(test.Opts, s, err)
+			}
+		}
+	}
+}
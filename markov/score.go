@@ -0,0 +1,162 @@
+package main
+
+import "math"
+
+// Smoothing assigns a probability to every token following a prefix key,
+// including tokens that were never seen after it.
+type Smoothing interface {
+	Prob(m counts, key NGram, w Token) float64
+}
+
+// counts is the part of a model that smoothing works with, which does not
+// depend on the type of its symbols.
+type counts interface {
+	order() int
+	vocabSize() int
+	known(key NGram, n int) bool
+	suffix(key NGram, n int) NGram
+	follow(key NGram, n int) *Transitions
+	kneserNey() *knStats
+}
+
+// AddK adds K to the count of every token in the vocabulary.
+type AddK struct{ K float64 }
+
+// KneserNey is interpolated Kneser-Ney smoothing with absolute discount D.
+// Lower orders use continuation counts, which are derived from the prefixes
+// of length Order, so it works with and without Backoff training.
+type KneserNey struct{ D float64 }
+
+// knStats holds continuation counts: cont is the number of distinct tokens
+// preceding a prefix+word, total and types are the sum of cont and the
+// number of words with non-zero cont for each prefix.
+type knStats struct {
+	cont  map[NGram]int
+	total map[NGram]int
+	types map[NGram]int
+}
+
+// vocabSize counts all tokens that can be predicted: words, EOS and None,
+// which stands for unknown words.
+func (m *Model[T]) vocabSize() int { return len(m.Vocab.Words) - 1 }
+
+func (m *Model[T]) order() int { return m.Order }
+
+// tokens maps words to tokens without interning, unknown words become None.
+func (m *Model[T]) tokens(words []T) []Token {
+	ids := make([]Token, len(words))
+	for i, w := range words {
+		ids[i] = m.Vocab.IDs[w]
+	}
+	return ids
+}
+
+func (a AddK) Prob(m counts, key NGram, w Token) float64 {
+	c, total := 0.0, 0.0
+	if t := m.follow(key, m.order()); t != nil {
+		if i := t.find(w); i >= 0 {
+			c = float64(t.Count[i])
+		}
+		total = float64(t.Total)
+	}
+	return (c + a.K) / (total + a.K*float64(m.vocabSize()))
+}
+
+func (kn KneserNey) Prob(m counts, key NGram, w Token) float64 {
+	s := m.kneserNey()
+	p := 1 / float64(m.vocabSize())
+	for n := 0; n <= m.order() && m.known(key, n); n++ {
+		var c, total, types float64
+		if n == m.order() {
+			t := m.follow(key, n)
+			if t == nil {
+				continue
+			}
+			if i := t.find(w); i >= 0 {
+				c = float64(t.Count[i])
+			}
+			total, types = float64(t.Total), float64(len(t.Next))
+		} else {
+			ctx := m.suffix(key, n)
+			if total = float64(s.total[ctx]); total == 0 {
+				continue
+			}
+			types = float64(s.types[ctx])
+			if w != None {
+				ctx[n] = w
+				c = float64(s.cont[ctx])
+			}
+		}
+		p = math.Max(c-kn.D, 0)/total + kn.D*types/total*p
+	}
+	return p
+}
+
+func (m *Model[T]) kneserNey() *knStats {
+	if m.kn != nil {
+		return m.kn
+	}
+	s := &knStats{cont: map[NGram]int{}, total: map[NGram]int{}, types: map[NGram]int{}}
+	seen := map[NGram]bool{}
+	for key, t := range m.Chain {
+		if key[m.Order-1] == None {
+			continue // shorter prefixes trained for backoff
+		}
+		for _, w := range t.Next {
+			for n := 0; n < m.Order; n++ {
+				if n < m.Order-1 {
+					// The same preceding token, prefix and word may come
+					// from several keys, count it once.
+					var gram NGram
+					copy(gram[:], key[m.Order-n-1:m.Order])
+					gram[n+1] = w
+					if seen[gram] {
+						continue
+					}
+					seen[gram] = true
+				}
+				ctx := m.suffix(key, n)
+				s.total[ctx]++
+				gram := ctx
+				gram[n] = w
+				if s.cont[gram]++; s.cont[gram] == 1 {
+					s.types[ctx]++
+				}
+			}
+		}
+	}
+	m.kn = s
+	return s
+}
+
+// LogProb returns the natural log probability of a sequence, including its
+// end, under the model's Smoothing.
+func (m *Model[T]) LogProb(words []T) float64 {
+	return m.logProb(m, words)
+}
+
+// logProb is LogProb with the counts that smoothing works with.
+func (m *Model[T]) logProb(c counts, words []T) float64 {
+	lp := 0.0
+	key := m.start()
+	for _, w := range append(m.tokens(words), EOS) {
+		lp += math.Log(m.Smoothing.Prob(c, key, w))
+		copy(key[:], key[1:m.Order])
+		key[m.Order-1] = w
+	}
+	return lp
+}
+
+// Perplexity returns the per-token perplexity of a corpus of sequences,
+// or 1 for an empty corpus.
+func (m *Model[T]) Perplexity(corpus [][]T) float64 {
+	lp, n := 0.0, 0
+	for _, words := range corpus {
+		lp += m.LogProb(words)
+		n += len(words) + 1
+	}
+	if n == 0 {
+		return 1
+	}
+	return math.Exp(-lp / float64(n))
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestSmoothing(t *testing.T) {
+	for _, smoothing := range []Smoothing{AddK{K: 1}, AddK{K: 0.1}, KneserNey{D: 0.75}} {
+		for _, backoff := range []Backoff{NoBackoff, Interpolated} {
+			m := NewMarkov(2)
+			m.Backoff, m.Smoothing = backoff, smoothing
+			for _, s := range []string{"Mary had a little lamb", "Old McDonald had a farm", "a little farm"} {
+				m.Add(strings.Fields(s))
+			}
+			for _, prefix := range []string{"", "had a", "a little", "the little", "had no", "no no"} {
+				key := m.start()
+				for _, w := range m.tokens(strings.Fields(prefix)) {
+					copy(key[:], key[1:m.Order])
+					key[m.Order-1] = w
+				}
+				sum := 0.0
+				for w := range m.Vocab.Words {
+					if Token(w) != BOS {
+						sum += smoothing.Prob(m, key, Token(w))
+					}
+				}
+				if math.Abs(sum-1) > 1e-9 {
+					t.Error(smoothing, backoff, prefix, sum)
+				}
+			}
+			seen := m.LogProb(strings.Fields("Mary had a little farm"))
+			unseen := m.LogProb(strings.Fields("farm a had little Mary"))
+			if seen >= 0 || seen <= unseen {
+				t.Error(smoothing, seen, unseen)
+			}
+			if pp := m.Perplexity([][]string{strings.Fields("Mary had a little farm")}); math.Abs(pp-math.Exp(-seen/6)) > 1e-9 {
+				t.Error(smoothing, pp)
+			}
+			if pp := m.Perplexity(nil); pp != 1 {
+				t.Error(smoothing, pp)
+			}
+		}
+	}
+}
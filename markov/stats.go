@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Stats summarizes the full-length prefixes of a chain, called states.
+type Stats[T comparable] struct {
+	Words       int             // vocabulary size, without the reserved tokens
+	States      int             // prefixes followed by anything
+	Transitions int             // distinct pairs of a state and a next word
+	Branching   map[int]int     // number of states by number of distinct next words
+	Entropy     map[int]int     // number of states by entropy of the next word, in whole bits
+	MeanEntropy float64         // entropy of the next word in bits, averaged over state visits
+	Top         []Transition[T] // most frequent transitions, most frequent first
+}
+
+// Transition is a state, one of its next words and how often it was seen.
+type Transition[T comparable] struct {
+	Prefix []T
+	Next   T
+	Count  int
+}
+
+// Stats returns statistics of the chain with the top most frequent
+// transitions.
+func (m *Model[T]) Stats(top int) Stats[T] {
+	s := Stats[T]{Words: len(m.Vocab.Words) - int(EOS+1), Branching: map[int]int{}, Entropy: map[int]int{}}
+	type transition struct {
+		key   NGram
+		next  Token
+		count int
+	}
+	var all []transition
+	visits := 0
+	for _, key := range m.states() {
+		t := m.Chain[key]
+		h := entropy(t)
+		s.States++
+		s.Transitions += len(t.Next)
+		s.Branching[len(t.Next)]++
+		s.Entropy[int(h)]++
+		s.MeanEntropy += h * float64(t.Total)
+		visits += t.Total
+		for i, next := range t.Next {
+			all = append(all, transition{key, next, t.Count[i]})
+		}
+	}
+	if visits > 0 {
+		s.MeanEntropy /= float64(visits)
+	}
+	sort.SliceStable(all, func(i, j int) bool { return all[i].count > all[j].count })
+	for _, t := range all[:min(top, len(all))] {
+		s.Top = append(s.Top, Transition[T]{m.Vocab.Symbols(t.key[:m.Order]), m.Vocab.Words[t.next], t.count})
+	}
+	return s
+}
+
+// states returns the full-length keys with successors in a stable order.
+func (m *Model[T]) states() []NGram {
+	var keys []NGram
+	for key, t := range m.Chain {
+		if key[m.Order-1] != None && t.Total > 0 {
+			keys = append(keys, key)
+		}
+	}
+	slices.SortFunc(keys, func(a, b NGram) int { return slices.Compare(a[:], b[:]) })
+	return keys
+}
+
+// entropy returns the entropy of the successors in bits.
+func entropy(t *Transitions) (h float64) {
+	for _, c := range t.Count {
+		p := float64(c) / float64(t.Total)
+		h -= p * math.Log2(p)
+	}
+	return h
+}
+
+// WriteDOT writes a Graphviz graph of the states reachable in up to depth
+// steps from the states ending with prefix, or from the beginning of a
+// sequence if prefix is empty. Only the width most frequent next words of
+// every state are followed. Edges are labeled with their probability and
+// count.
+func (m *Model[T]) WriteDOT(w io.Writer, prefix []T, depth, width int) error {
+	frontier := []NGram{m.start()}
+	if len(prefix) > 0 {
+		tail, n := m.tail(prefix), min(len(prefix), m.Order)
+		frontier = nil
+		for _, key := range m.states() {
+			if slices.Equal(key[m.Order-n:m.Order], tail[m.Order-n:m.Order]) {
+				frontier = append(frontier, key)
+			}
+		}
+		if len(frontier) == 0 {
+			return ErrUnknown
+		}
+		sort.SliceStable(frontier, func(i, j int) bool { return m.Chain[frontier[i]].Total > m.Chain[frontier[j]].Total })
+		frontier = frontier[:min(width, len(frontier))]
+	}
+	bw := bufio.NewWriter(w)
+	ids := map[NGram]int{}
+	node := func(key NGram, label string) int {
+		id, ok := ids[key]
+		if !ok {
+			id = len(ids)
+			ids[key] = id
+			fmt.Fprintf(bw, "  s%d [label=%q];\n", id, label)
+		}
+		return id
+	}
+	fmt.Fprintln(bw, "digraph markov {")
+	for _, key := range frontier {
+		ids[key] = len(ids)
+		fmt.Fprintf(bw, "  s%d [label=%q, style=bold];\n", ids[key], m.label(key[:m.Order]))
+	}
+	for step := 0; step < depth && len(frontier) > 0; step++ {
+		var next []NGram
+		for _, key := range frontier {
+			t := m.Chain[key]
+			if t == nil {
+				continue
+			}
+			order := make([]int, len(t.Next))
+			for i := range order {
+				order[i] = i
+			}
+			sort.SliceStable(order, func(i, j int) bool { return t.Count[order[i]] > t.Count[order[j]] })
+			for _, i := range order[:min(width, len(order))] {
+				to := key
+				copy(to[:], to[1:m.Order])
+				to[m.Order-1] = t.Next[i]
+				if _, seen := ids[to]; !seen && t.Next[i] != EOS {
+					next = append(next, to)
+				}
+				label := m.label(to[:m.Order])
+				if t.Next[i] == EOS {
+					to, label = NGram{EOS}, m.label([]Token{EOS})
+				}
+				p := float64(t.Count[i]) / float64(t.Total)
+				fmt.Fprintf(bw, "  s%d -> s%d [label=\"%.2f (%d)\", penwidth=%.1f];\n",
+					ids[key], node(to, label), p, t.Count[i], 1+4*p)
+			}
+		}
+		frontier = next
+	}
+	fmt.Fprintln(bw, "}")
+	return bw.Flush()
+}
+
+// label returns the words of tokens separated with spaces.
+func (m *Model[T]) label(tokens []Token) string {
+	words := make([]string, len(tokens))
+	for i, w := range m.Vocab.Symbols(tokens) {
+		words[i] = fmt.Sprint(w)
+	}
+	return strings.Join(words, " ")
+}
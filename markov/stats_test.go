@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	m := NewMarkov(1)
+	for _, s := range []string{"a b", "a c", "a b"} {
+		m.Add(strings.Fields(s))
+	}
+	s := m.Stats(2)
+	if s.Words != 3 || s.States != 4 || s.Transitions != 5 {
+		t.Error(s)
+	}
+	if !reflect.DeepEqual(s.Branching, map[int]int{1: 3, 2: 1}) || !reflect.DeepEqual(s.Entropy, map[int]int{0: 4}) {
+		t.Error(s.Branching, s.Entropy)
+	}
+	h := -(2.0/3*math.Log2(2.0/3) + 1.0/3*math.Log2(1.0/3))
+	if math.Abs(s.MeanEntropy-h*3/9) > 1e-9 {
+		t.Error(s.MeanEntropy)
+	}
+	top := []Transition[string]{{[]string{"<s>"}, "a", 3}, {[]string{"a"}, "b", 2}}
+	if !reflect.DeepEqual(s.Top, top) {
+		t.Error(s.Top)
+	}
+}
+
+func TestWriteDOT(t *testing.T) {
+	m := NewMarkov(1)
+	for _, s := range []string{"a b", "a c", "a b"} {
+		m.Add(strings.Fields(s))
+	}
+	var buf bytes.Buffer
+	if err := m.WriteDOT(&buf, []string{"a"}, 2, 1); err != nil {
+		t.Fatal(err)
+	}
+	want := `digraph markov {
+  s0 [label="a", style=bold];
+  s1 [label="b"];
+  s0 -> s1 [label="0.67 (2)", penwidth=3.7];
+  s2 [label="</s>"];
+  s1 -> s2 [label="1.00 (2)", penwidth=5.0];
+}
+`
+	if buf.String() != want {
+		t.Error(buf.String())
+	}
+	if err := m.WriteDOT(&buf, []string{"z"}, 2, 1); err != ErrUnknown {
+		t.Error(err)
+	}
+}
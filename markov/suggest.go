@@ -0,0 +1,65 @@
+package main
+
+import (
+	"slices"
+	"sort"
+)
+
+// Suggestion is a possible next word and its probability.
+type Suggestion[T comparable] struct {
+	Word T
+	Prob float64
+}
+
+// Suggest returns the k most likely words following context, most likely
+// first, or all of them if k is 0. The end of a sequence is not suggested.
+// If the last Order words of the context were never seen together, the
+// words following its longest seen ending are suggested.
+func (m *Model[T]) Suggest(context []T, k int) []Suggestion[T] {
+	key := m.tail(context)
+	tokens, probs := m.dist(key)
+	for n := m.Order - 1; len(tokens) == 0 && n >= 0; n-- {
+		tokens, probs = m.pooled(key, n)
+	}
+	order := make([]int, len(tokens))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return probs[order[i]] > probs[order[j]] })
+	var out []Suggestion[T]
+	for _, i := range order {
+		if k > 0 && len(out) == k {
+			break
+		}
+		if tokens[i] != EOS {
+			out = append(out, Suggestion[T]{m.Vocab.Words[tokens[i]], probs[i]})
+		}
+	}
+	return out
+}
+
+// pooled returns the tokens following any full-length key ending with the
+// last n tokens of key, and their probabilities. It is used for models
+// trained without Backoff, which have no shorter keys.
+func (m *Model[T]) pooled(key NGram, n int) (tokens []Token, probs []float64) {
+	if !m.known(key, n) {
+		return nil, nil
+	}
+	var keys []NGram
+	for k := range m.Chain {
+		if k[m.Order-1] != None && slices.Equal(k[m.Order-n:m.Order], key[m.Order-n:m.Order]) {
+			keys = append(keys, k)
+		}
+	}
+	slices.SortFunc(keys, func(a, b NGram) int { return slices.Compare(a[:], b[:]) })
+	t := &Transitions{}
+	for _, k := range keys {
+		for i, w := range m.Chain[k].Next {
+			t.add(w, m.Chain[k].Count[i])
+		}
+	}
+	for i, w := range t.Next {
+		tokens, probs = append(tokens, w), append(probs, float64(t.Count[i])/float64(t.Total))
+	}
+	return tokens, probs
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSuggest(t *testing.T) {
+	for _, backoff := range []Backoff{NoBackoff, StupidBackoff} {
+		m := NewMarkov(2)
+		m.Backoff = backoff
+		for _, s := range []string{"the cat sat", "the cat ran", "the cat sat down", "a dog sat"} {
+			m.Add(strings.Fields(s))
+		}
+		var words []string
+		suggestions := m.Suggest(strings.Fields("the cat"), 2)
+		for _, s := range suggestions {
+			words = append(words, s.Word)
+		}
+		if !reflect.DeepEqual(words, []string{"sat", "ran"}) || suggestions[0].Prob <= suggestions[1].Prob {
+			t.Error(backoff, suggestions)
+		}
+		// "big cat" was never seen, the words after "cat" are suggested
+		if s := m.Suggest(strings.Fields("a big cat"), 1); len(s) != 1 || s[0].Word != "sat" {
+			t.Error(backoff, s)
+		}
+		// The end of a sequence is not a word
+		if s := m.Suggest(strings.Fields("the cat sat down"), 0); len(s) != 0 && backoff == NoBackoff {
+			t.Error(backoff, s)
+		}
+		// Nothing is known, every word is suggested by frequency
+		if s := m.Suggest(strings.Fields("zebra"), 0); len(s) != 7 || s[2].Prob <= s[3].Prob {
+			t.Error(backoff, s)
+		}
+	}
+}
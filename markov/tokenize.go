@@ -0,0 +1,207 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Abbreviations whose trailing period does not end a sentence.
+var abbreviations = map[string]bool{
+	"mr": true, "mrs": true, "ms": true, "dr": true, "prof": true, "st": true,
+	"jr": true, "sr": true, "vs": true, "etc": true, "e.g": true, "i.e": true,
+	"inc": true, "co": true, "no": true,
+}
+
+func isTerminal(r rune) bool { return r == '.' || r == '!' || r == '?' }
+func isClosing(r rune) bool  { return strings.ContainsRune(`"')]}”’`, r) }
+func isWordRune(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }
+
+// endsSentence reports if a token ends with terminal punctuation, possibly
+// followed by closing quotes or brackets.
+func endsSentence(token string) bool {
+	r, _ := utf8.DecodeLastRuneInString(strings.TrimRightFunc(token, isClosing))
+	return isTerminal(r)
+}
+
+// ScanSentences is a bufio.SplitFunc that returns one sentence at a time.
+// Sentences end with terminal punctuation followed by a space, or at a
+// blank line, and may span line breaks.
+func ScanSentences(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	start := 0
+	for start < len(data) {
+		r, n := utf8.DecodeRune(data[start:])
+		if !unicode.IsSpace(r) {
+			break
+		}
+		start += n
+	}
+	for i := start; i < len(data); {
+		r, n := utf8.DecodeRune(data[i:])
+		if r == '\n' {
+			j := i + n
+			for j < len(data) && (data[j] == ' ' || data[j] == '\t' || data[j] == '\r') {
+				j++
+			}
+			if j < len(data) && data[j] == '\n' {
+				return j + 1, data[start:i], nil
+			}
+		}
+		if !isTerminal(r) {
+			i += n
+			continue
+		}
+		end := i + n
+		for end < len(data) && isTerminal(rune(data[end])) {
+			end++
+		}
+		for end < len(data) {
+			c, size := utf8.DecodeRune(data[end:])
+			if !isClosing(c) {
+				break
+			}
+			end += size
+		}
+		if end == len(data) && !atEOF {
+			break
+		}
+		if end < len(data) {
+			if c, _ := utf8.DecodeRune(data[end:]); !unicode.IsSpace(c) {
+				i = end
+				continue
+			}
+		}
+		if end == i+1 && r == '.' && !atEOF && !hasWord(data[end:]) {
+			break
+		}
+		if end == i+1 && r == '.' && isAbbreviation(string(data[start:i]), string(data[end:])) {
+			i = end
+			continue
+		}
+		return end, data[start:end], nil
+	}
+	if atEOF && start < len(data) {
+		return len(data), data[start:], nil
+	}
+	if atEOF {
+		return len(data), nil, nil
+	}
+	return start, nil, nil
+}
+
+// hasWord reports if data holds a whole word after leading spaces, so that
+// it is known whether a period before it ends an initial.
+func hasWord(data []byte) bool {
+	word := false
+	for _, r := range string(data) {
+		if unicode.IsSpace(r) && word {
+			return true
+		}
+		word = word || !unicode.IsSpace(r)
+	}
+	return false
+}
+
+// isAbbreviation reports if the last word of s, followed by a period and
+// next, is an abbreviation or an initial, such as the "J" in "J. R. R.
+// Tolkien". A single capital letter is an initial only before a capitalized
+// word, and after a lowercase word only before another initial, so that
+// "plan B." still ends a sentence.
+func isAbbreviation(s, next string) bool {
+	before, after := strings.Fields(s), strings.Fields(next)
+	if len(before) == 0 {
+		return false
+	}
+	word := trimWord(before[len(before)-1])
+	r, n := utf8.DecodeRuneInString(word)
+	if n == 0 || n < len(word) {
+		return abbreviations[strings.ToLower(word)]
+	}
+	if !unicode.IsUpper(r) || r == 'I' || len(after) == 0 {
+		return false
+	}
+	following := trimWord(after[0])
+	c, n := utf8.DecodeRuneInString(following)
+	switch {
+	case !unicode.IsUpper(c):
+		return false
+	case following[n:] == "." && c != 'I':
+		return true
+	case len(before) > 1:
+		prev, _ := utf8.DecodeRuneInString(trimWord(before[len(before)-2]))
+		return !unicode.IsLower(prev)
+	}
+	return true
+}
+
+// trimWord removes the punctuation, such as quotes, before a word.
+func trimWord(s string) string {
+	return strings.TrimLeftFunc(s, func(r rune) bool { return !isWordRune(r) })
+}
+
+// Tokenize splits a sentence into words and punctuation. Apostrophes,
+// hyphens and dots inside a word are kept, as is the period of an
+// abbreviation. Runs of terminal punctuation form a single token.
+func Tokenize(sentence string) (tokens []string) {
+	runes := []rune(sentence)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		j := i + 1
+		switch {
+		case unicode.IsSpace(r):
+			i = j
+			continue
+		case isWordRune(r):
+			for j < len(runes) && (isWordRune(runes[j]) ||
+				(strings.ContainsRune("'’-.", runes[j]) && j+1 < len(runes) && isWordRune(runes[j+1]))) {
+				j++
+			}
+			if j < len(runes) && runes[j] == '.' && isAbbreviation(string(runes[:j]), string(runes[j+1:])) {
+				j++
+			}
+		case isTerminal(r):
+			for j < len(runes) && isTerminal(runes[j]) {
+				j++
+			}
+		case r == '-':
+			for j < len(runes) && runes[j] == '-' {
+				j++
+			}
+		}
+		tokens = append(tokens, string(runes[i:j]))
+		i = j
+	}
+	return tokens
+}
+
+// Detokenize joins tokens produced by Tokenize back into text. Punctuation
+// is attached to its neighbours and sentence starts are capitalized.
+func Detokenize(tokens []string) string {
+	var sb strings.Builder
+	capital, space, quoted := true, false, false
+	for _, t := range tokens {
+		if t == "" {
+			continue
+		}
+		r, _ := utf8.DecodeRuneInString(t)
+		attach := strings.ContainsRune(",;:%)]}", r) || isTerminal(r) || t == "'" || t == "’"
+		opening := strings.ContainsRune("([{", r)
+		if t == `"` {
+			attach, opening, quoted = quoted, !quoted, !quoted
+		}
+		if space && !attach {
+			sb.WriteByte(' ')
+		}
+		if isWordRune(r) && (capital || t == "i") {
+			t = string(unicode.ToUpper(r)) + t[utf8.RuneLen(r):]
+		}
+		sb.WriteString(t)
+		if isWordRune(r) {
+			capital = false
+		} else if isTerminal(r) {
+			capital = true
+		}
+		space = !opening
+	}
+	return sb.String()
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bufio"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestScanSentences(t *testing.T) {
+	text := "Hello, Mr. Smith! How are\nyou today?  I'm fine...\n\nA heading\n\nSaid \"J. R. R. Tolkien.\" Then"
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	scanner.Split(ScanSentences)
+	var sentences []string
+	for scanner.Scan() {
+		sentences = append(sentences, scanner.Text())
+	}
+	if want := []string{
+		"Hello, Mr. Smith!",
+		"How are\nyou today?",
+		"I'm fine...",
+		"A heading",
+		"Said \"J. R. R. Tolkien.\"",
+		"Then",
+	}; !reflect.DeepEqual(sentences, want) {
+		t.Errorf("%q", sentences)
+	}
+	// A single capital ends a sentence unless it is an initial of a name
+	text = "I got an A. Then I left. We need a plan B. Take vitamin C. Ask John F. Kennedy. Met J. R. Smith."
+	scanner = bufio.NewScanner(strings.NewReader(text))
+	scanner.Split(ScanSentences)
+	sentences = nil
+	for scanner.Scan() {
+		sentences = append(sentences, scanner.Text())
+	}
+	if want := []string{
+		"I got an A.",
+		"Then I left.",
+		"We need a plan B.",
+		"Take vitamin C.",
+		"Ask John F. Kennedy.",
+		"Met J. R. Smith.",
+	}; !reflect.DeepEqual(sentences, want) {
+		t.Errorf("%q", sentences)
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	for _, test := range []struct {
+		Text   string
+		Tokens string
+		Joined string
+	}{
+		{"", "", ""},
+		{"Hello, world!", "Hello|,|world|!", "Hello, world!"},
+		{"i don't know... do you?!", "i|don't|know|...|do|you|?!", "I don't know... Do you?!"},
+		{"Ask Mr. Burns (he knows).", "Ask|Mr.|Burns|(|he|knows|)|.", "Ask Mr. Burns (he knows)."},
+		{`She said "stop" -- twice`, `She|said|"|stop|"|--|twice`, `She said "stop" -- twice`},
+		{"a well-known 3.14 fact", "a|well-known|3.14|fact", "A well-known 3.14 fact"},
+		{"I got an A.", "I|got|an|A|.", "I got an A."},
+		{"by J. R. R. Tolkien", "by|J.|R.|R.|Tolkien", "By J. R. R. Tolkien"},
+	} {
+		tokens := Tokenize(test.Text)
+		if s := strings.Join(tokens, "|"); s != test.Tokens {
+			t.Error(test.Text, s)
+		}
+		if s := Detokenize(tokens); s != test.Joined {
+			t.Error(test.Text, s)
+		}
+	}
+}